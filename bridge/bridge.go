@@ -0,0 +1,341 @@
+package bridge
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/infinit-lab/gravity/event"
+	"github.com/infinit-lab/gravity/printer"
+	uuid "github.com/satori/go.uuid"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Options struct {
+	Bus               *event.Bus
+	Topics            []string
+	ReconnectInterval time.Duration
+	SeenTimeout       time.Duration
+	WriteTimeout      time.Duration
+}
+
+type Bridge interface {
+	Listen(network string, address string) error
+	Dial(network string, address string) error
+	DialWebsocket(url string) error
+	HandlerFunc() gin.HandlerFunc
+	Close()
+}
+
+func New(options Options) (Bridge, error) {
+	if len(options.Topics) == 0 {
+		return nil, errors.New("No topic to bridge. ")
+	}
+	if options.ReconnectInterval <= 0 {
+		options.ReconnectInterval = 5 * time.Second
+	}
+	if options.SeenTimeout <= 0 {
+		options.SeenTimeout = time.Minute
+	}
+	if options.WriteTimeout <= 0 {
+		options.WriteTimeout = 10 * time.Second
+	}
+	if options.Bus == nil {
+		options.Bus = event.Default()
+	}
+	b := new(bridge)
+	b.options = options
+	b.peerMap = make(map[peer]bool)
+	b.seenMap = make(map[string]time.Time)
+	b.closeChan = make(chan int)
+
+	var err error
+	b.subscriber, err = options.Bus.SubscribeWithOptions("", event.Options{
+		Filter: func(e *event.Event) bool {
+			return b.isBridged(e.Topic)
+		},
+	})
+	if err != nil {
+		printer.Error(err)
+		return nil, err
+	}
+	go b.forwardLoop()
+	return b, nil
+}
+
+var upgrader websocket.Upgrader
+
+type peer interface {
+	send(data []byte) error
+	close()
+}
+
+type bridge struct {
+	options    Options
+	subscriber event.Subscriber
+	peerMap    map[peer]bool
+	peerMutex  sync.Mutex
+	seenMap    map[string]time.Time
+	seenMutex  sync.Mutex
+	listeners  []net.Listener
+	closeChan  chan int
+	closeOnce  sync.Once
+}
+
+func (b *bridge) isBridged(topic string) bool {
+	for _, pattern := range b.options.Topics {
+		if event.MatchTopic(pattern, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *bridge) isClosed() bool {
+	select {
+	case <-b.closeChan:
+		return true
+	default:
+		return false
+	}
+}
+
+func (b *bridge) markSeen(id string) bool {
+	b.seenMutex.Lock()
+	defer b.seenMutex.Unlock()
+	now := time.Now()
+	if t, ok := b.seenMap[id]; ok && now.Sub(t) < b.options.SeenTimeout {
+		return false
+	}
+	b.seenMap[id] = now
+	return true
+}
+
+func (b *bridge) pruneSeen() {
+	b.seenMutex.Lock()
+	defer b.seenMutex.Unlock()
+	now := time.Now()
+	for id, t := range b.seenMap {
+		if now.Sub(t) >= b.options.SeenTimeout {
+			delete(b.seenMap, id)
+		}
+	}
+}
+
+func (b *bridge) addPeer(p peer) {
+	b.peerMutex.Lock()
+	defer b.peerMutex.Unlock()
+	b.peerMap[p] = true
+}
+
+func (b *bridge) removePeer(p peer) {
+	b.peerMutex.Lock()
+	defer b.peerMutex.Unlock()
+	delete(b.peerMap, p)
+}
+
+func (b *bridge) getPeerList() (peerList []peer) {
+	b.peerMutex.Lock()
+	defer b.peerMutex.Unlock()
+	for p := range b.peerMap {
+		peerList = append(peerList, p)
+	}
+	return
+}
+
+func (b *bridge) broadcast(data []byte, except peer) {
+	for _, p := range b.getPeerList() {
+		if p == except {
+			continue
+		}
+		if err := p.send(data); err != nil {
+			printer.Error(err)
+			p.close()
+		}
+	}
+}
+
+func (b *bridge) forwardLoop() {
+	ticker := time.NewTicker(b.options.SeenTimeout)
+	defer ticker.Stop()
+	for {
+		select {
+		case e, ok := <-b.subscriber.Event():
+			if !ok {
+				return
+			}
+			id := e.Id
+			if len(id) == 0 {
+				id = strings.ReplaceAll(uuid.NewV4().String(), "-", "")
+			}
+			if !b.markSeen(id) {
+				continue
+			}
+			temp := *e
+			temp.Id = id
+			data, err := event.Marshal(&temp)
+			if err != nil {
+				printer.Error(err)
+				continue
+			}
+			b.broadcast(data, nil)
+		case <-ticker.C:
+			b.pruneSeen()
+		case <-b.closeChan:
+			return
+		}
+	}
+}
+
+func (b *bridge) receive(p peer, data []byte) {
+	e, err := event.Unmarshal(data)
+	if err != nil {
+		printer.Error(err)
+		return
+	}
+	if len(e.Id) == 0 || len(e.Topic) == 0 {
+		printer.Warning("Invalid bridge message. ")
+		return
+	}
+	if !b.isBridged(e.Topic) {
+		printer.Warning("Drop bridge message of unbridged topic ", e.Topic)
+		return
+	}
+	if !b.markSeen(e.Id) {
+		return
+	}
+	b.broadcast(data, p)
+	if err := b.options.Bus.Publish(e); err != nil {
+		printer.Error(err)
+	}
+}
+
+func (b *bridge) serve(p peer, read func() ([]byte, error)) {
+	b.addPeer(p)
+	defer func() {
+		b.removePeer(p)
+		p.close()
+	}()
+	for {
+		data, err := read()
+		if err != nil {
+			if !b.isClosed() {
+				printer.Error(err)
+			}
+			return
+		}
+		b.receive(p, data)
+	}
+}
+
+func (b *bridge) Listen(network string, address string) error {
+	if network == "unix" {
+		if info, err := os.Stat(address); err == nil && info.Mode()&os.ModeSocket != 0 {
+			_ = os.Remove(address)
+		}
+	}
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		printer.Error(err)
+		return err
+	}
+	b.peerMutex.Lock()
+	b.listeners = append(b.listeners, listener)
+	b.peerMutex.Unlock()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if !b.isClosed() {
+					printer.Error(err)
+				}
+				return
+			}
+			p := newStreamPeer(conn, b.options.WriteTimeout)
+			go b.serve(p, p.read)
+		}
+	}()
+	return nil
+}
+
+func (b *bridge) Dial(network string, address string) error {
+	if len(address) == 0 {
+		return errors.New("Address is empty. ")
+	}
+	go b.reconnectLoop(func() (peer, func() ([]byte, error), error) {
+		conn, err := net.Dial(network, address)
+		if err != nil {
+			return nil, nil, err
+		}
+		p := newStreamPeer(conn, b.options.WriteTimeout)
+		return p, p.read, nil
+	})
+	return nil
+}
+
+func (b *bridge) DialWebsocket(url string) error {
+	if len(url) == 0 {
+		return errors.New("Url is empty. ")
+	}
+	go b.reconnectLoop(func() (peer, func() ([]byte, error), error) {
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		p := newWebsocketPeer(conn, b.options.WriteTimeout)
+		return p, p.read, nil
+	})
+	return nil
+}
+
+func (b *bridge) reconnectLoop(connect func() (peer, func() ([]byte, error), error)) {
+	for !b.isClosed() {
+		p, read, err := connect()
+		if err != nil {
+			printer.Error(err)
+		} else {
+			b.serve(p, read)
+		}
+		select {
+		case <-time.After(b.options.ReconnectInterval):
+		case <-b.closeChan:
+			return
+		}
+	}
+}
+
+func (b *bridge) HandlerFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			printer.Error(err)
+			return
+		}
+		if b.isClosed() {
+			_ = conn.Close()
+			return
+		}
+		p := newWebsocketPeer(conn, b.options.WriteTimeout)
+		b.serve(p, p.read)
+	}
+}
+
+func (b *bridge) Close() {
+	b.closeOnce.Do(func() {
+		close(b.closeChan)
+		b.subscriber.Unsubscribe()
+		b.peerMutex.Lock()
+		listeners := b.listeners
+		b.listeners = nil
+		b.peerMutex.Unlock()
+		for _, listener := range listeners {
+			_ = listener.Close()
+		}
+		for _, p := range b.getPeerList() {
+			p.close()
+		}
+	})
+}
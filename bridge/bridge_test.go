@@ -0,0 +1,146 @@
+package bridge
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/infinit-lab/gravity/event"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testPayload struct {
+	Name  string `json:"name"`
+	Value int    `json:"value"`
+}
+
+func TestBridge(t *testing.T) {
+	if err := event.RegisterType("bridge.a", &testPayload{}); err != nil {
+		t.Fatal(err)
+	}
+	address := filepath.Join(os.TempDir(), "gravity_bridge_test.sock")
+
+	a, err := New(Options{Topics: []string{"bridge.a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	if err := a.Listen("unix", address); err != nil {
+		t.Fatal(err)
+	}
+
+	remoteBus := event.NewBus()
+	b, err := New(Options{Bus: remoteBus, Topics: []string{"bridge.a", "bridge.b"}, ReconnectInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if err := b.Dial("unix", address); err != nil {
+		t.Fatal(err)
+	}
+
+	subscriber, err := event.SubscribeWithOptions("bridge.a", event.Options{BufferSize: 10, Policy: event.PolicyDropNewest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer subscriber.Unsubscribe()
+	remoteSubscriber, err := remoteBus.SubscribeWithOptions("bridge.a", event.Options{BufferSize: 10, Policy: event.PolicyDropNewest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remoteSubscriber.Unsubscribe()
+
+	time.Sleep(50 * time.Millisecond)
+	_ = event.Publish(&event.Event{Topic: "bridge.a", Status: "created", Data: &testPayload{Name: "test", Value: 1}})
+
+	local := <-subscriber.Event()
+	if len(local.Id) != 0 {
+		t.Fatal("Local event should not have an id. ")
+	}
+	timer := time.NewTimer(time.Second)
+	defer timer.Stop()
+	select {
+	case remote := <-remoteSubscriber.Event():
+		if len(remote.Id) == 0 {
+			t.Fatal("Bridged event should have an id. ")
+		}
+		payload, ok := remote.Data.(*testPayload)
+		if !ok || payload.Name != "test" || payload.Value != 1 {
+			t.Fatal("Unexpected payload ", remote.Data)
+		}
+	case <-timer.C:
+		t.Fatal("Event is not bridged. ")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case e := <-subscriber.Event():
+		t.Fatal("Bridged event should not loop back, got ", e.Id)
+	default:
+	}
+
+	unbridged, err := remoteBus.SubscribeWithOptions("bridge.c", event.Options{BufferSize: 10, Policy: event.PolicyDropNewest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unbridged.Unsubscribe()
+	data, err := event.Marshal(&event.Event{Id: "unbridged", Topic: "bridge.c", Status: "created"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.(*bridge).receive(nil, data)
+	if unbridged.(event.PendingCounter).Pending() != 0 {
+		t.Fatal("Event of unbridged topic should be dropped. ")
+	}
+}
+
+func TestBridgeWebsocket(t *testing.T) {
+	if err := event.RegisterType("bridge.ws", &testPayload{}); err != nil {
+		t.Fatal(err)
+	}
+	a, err := New(Options{Topics: []string{"bridge.ws"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := gin.New()
+	engine.GET("/bridge", a.HandlerFunc())
+	s := httptest.NewServer(engine)
+	defer s.Close()
+	defer a.Close()
+
+	remoteBus := event.NewBus()
+	b, err := New(Options{Bus: remoteBus, Topics: []string{"bridge.ws"}, ReconnectInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if err := b.DialWebsocket("ws" + strings.TrimPrefix(s.URL, "http") + "/bridge"); err != nil {
+		t.Fatal(err)
+	}
+
+	subscriber, err := event.SubscribeWithOptions("bridge.ws", event.Options{BufferSize: 200, Policy: event.PolicyDropNewest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer subscriber.Unsubscribe()
+
+	time.Sleep(50 * time.Millisecond)
+	count := 100
+	for i := 0; i < count; i++ {
+		_ = remoteBus.Publish(&event.Event{Topic: "bridge.ws", Status: "created", Data: &testPayload{Value: i}})
+	}
+	timer := time.NewTimer(time.Second)
+	defer timer.Stop()
+	for i := 0; i < count; i++ {
+		select {
+		case e := <-subscriber.Event():
+			if payload, ok := e.Data.(*testPayload); !ok || payload.Value != i {
+				t.Fatal("Bridged events should keep their order, expected ", i, " got ", e.Data)
+			}
+		case <-timer.C:
+			t.Fatal("Event is not bridged. ")
+		}
+	}
+}
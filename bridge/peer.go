@@ -0,0 +1,72 @@
+package bridge
+
+import (
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"net"
+	"sync"
+	"time"
+)
+
+type streamPeer struct {
+	conn         net.Conn
+	encoder      *json.Encoder
+	decoder      *json.Decoder
+	writeTimeout time.Duration
+	mutex        sync.Mutex
+}
+
+func newStreamPeer(conn net.Conn, writeTimeout time.Duration) *streamPeer {
+	p := new(streamPeer)
+	p.conn = conn
+	p.writeTimeout = writeTimeout
+	p.encoder = json.NewEncoder(conn)
+	p.decoder = json.NewDecoder(conn)
+	return p
+}
+
+func (p *streamPeer) send(data []byte) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	_ = p.conn.SetWriteDeadline(time.Now().Add(p.writeTimeout))
+	return p.encoder.Encode(json.RawMessage(data))
+}
+
+func (p *streamPeer) read() ([]byte, error) {
+	var data json.RawMessage
+	err := p.decoder.Decode(&data)
+	return data, err
+}
+
+func (p *streamPeer) close() {
+	_ = p.conn.Close()
+}
+
+type websocketPeer struct {
+	conn         *websocket.Conn
+	writeTimeout time.Duration
+	mutex        sync.Mutex
+}
+
+func newWebsocketPeer(conn *websocket.Conn, writeTimeout time.Duration) *websocketPeer {
+	p := new(websocketPeer)
+	p.conn = conn
+	p.writeTimeout = writeTimeout
+	return p
+}
+
+func (p *websocketPeer) send(data []byte) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	_ = p.conn.SetWriteDeadline(time.Now().Add(p.writeTimeout))
+	return p.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (p *websocketPeer) read() ([]byte, error) {
+	_, data, err := p.conn.ReadMessage()
+	return data, err
+}
+
+func (p *websocketPeer) close() {
+	_ = p.conn.Close()
+}
@@ -33,3 +33,7 @@ func GetBool(name string) bool {
 func GetFloat64(name string) float64 {
 	return reader.getFloat64(name)
 }
+
+func GetStringList(name string) []string {
+	return reader.getStringList(name)
+}
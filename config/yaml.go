@@ -134,6 +134,26 @@ func (r *yamlReader) getString(name string) string {
 	}
 }
 
+func (r *yamlReader) getStringList(name string) []string {
+	var list []string
+	switch value := r.get(name).(type) {
+	case []interface{}:
+		for _, v := range value {
+			if v != nil {
+				list = append(list, fmt.Sprint(v))
+			}
+		}
+	case string:
+		for _, v := range strings.Split(value, ",") {
+			v = strings.TrimSpace(v)
+			if len(v) != 0 {
+				list = append(list, v)
+			}
+		}
+	}
+	return list
+}
+
 func (r *yamlReader) getInt(name string) int {
 	value := r.get(name)
 	switch value := value.(type) {
@@ -11,7 +11,9 @@ import (
 	"github.com/infinit-lab/gravity/server"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
@@ -209,3 +211,102 @@ func TestControllerSessionMiddle(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestRateLimitMiddle(t *testing.T) {
+	os.Args = append(os.Args, "ratelimit.test.rate=1", "ratelimit.test.burst=2")
+	config.LoadArgs()
+	server.Router().GET("/ratelimit/test", RateLimitMiddle("test", nil), func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	get := func(ip string, forwarded ...string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, "/ratelimit/test", nil)
+		request.RemoteAddr = ip + ":12345"
+		if len(forwarded) != 0 {
+			request.Header.Set("X-Forwarded-For", forwarded[0])
+		}
+		recorder := httptest.NewRecorder()
+		server.Router().ServeHTTP(recorder, request)
+		return recorder
+	}
+	for i := 0; i < 2; i++ {
+		if get("10.0.0.1").Code != http.StatusOK {
+			t.Fatal("Request within burst should pass. ")
+		}
+	}
+	recorder := get("10.0.0.1")
+	if recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") != "1" {
+		t.Fatal("Request over limit should be rejected. ", recorder.Code, recorder.Header())
+	}
+	var response Response
+	_ = json.Unmarshal(recorder.Body.Bytes(), &response)
+	if response.Result || response.Error != "Too Many Requests" {
+		t.Fatal("Unexpected response ", recorder.Body.String())
+	}
+	if get("10.0.0.2").Code != http.StatusOK {
+		t.Fatal("Other client should not be limited. ")
+	}
+
+	for i := 0; i < 2; i++ {
+		get("10.0.0.3", "192.168.0."+strconv.Itoa(i))
+	}
+	if get("10.0.0.3", "192.168.0.9").Code != http.StatusTooManyRequests {
+		t.Fatal("Forwarded header from untrusted peer should be ignored. ")
+	}
+
+	os.Args = append(os.Args, "server.trustedProxies=10.0.1.0/24")
+	config.LoadArgs()
+	for i := 0; i < 2; i++ {
+		if get("10.0.1.1", "192.168.1.1").Code != http.StatusOK {
+			t.Fatal("Request within burst should pass. ")
+		}
+	}
+	if get("10.0.1.1", "192.168.1.1").Code != http.StatusTooManyRequests {
+		t.Fatal("Forwarded client should be limited. ")
+	}
+	if get("10.0.1.1", "192.168.1.2").Code != http.StatusOK {
+		t.Fatal("Forwarded header from trusted proxy should be used. ")
+	}
+}
+
+func TestProxyWithSession(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.RequestURI() + "|" + r.Header.Get("Authorization") + "|" +
+			r.Header.Get(server.ProxyUserIdHeader) + "|" + r.Header.Get(server.ProxyUsernameHeader)))
+	}))
+	defer backend.Close()
+	if err := ProxyWithSession("/proxy", backend.URL, server.ProxyOptions{StripPrefix: true}); err != nil {
+		t.Fatal(err)
+	}
+	session, err := CreateSession("1", "tester", "127.0.0.1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	front := httptest.NewServer(server.Router())
+	defer front.Close()
+
+	get := func(target string, token string) (int, string) {
+		request, _ := http.NewRequest(http.MethodGet, front.URL+target, nil)
+		if len(token) != 0 {
+			request.Header.Set("Authorization", token)
+		}
+		request.Header.Set(server.ProxyUsernameHeader, "root")
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(response.Body)
+		_ = response.Body.Close()
+		return response.StatusCode, string(body)
+	}
+	if code, _ := get("/proxy/users", ""); code != http.StatusUnauthorized {
+		t.Fatal("Request without session should be rejected. ")
+	}
+	if _, body := get("/proxy/users?a=1", session.Token); body != "/users?a=1||1|tester" {
+		t.Fatal("Unexpected proxy request ", body)
+	}
+	if _, body := get("/proxy/users?a=1&token="+session.Token, ""); body != "/users?a=1||1|tester" {
+		t.Fatal("Unexpected proxy request ", body)
+	}
+}
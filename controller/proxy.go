@@ -0,0 +1,22 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/infinit-lab/gravity/server"
+)
+
+func ProxyWithSession(prefix string, target string, options server.ProxyOptions) error {
+	middle := sessionMiddleFunc(nil)
+	middle = append(middle, proxyIdentityMiddle())
+	options.Middle = append(middle, options.Middle...)
+	return server.Proxy(prefix, target, options)
+}
+
+func proxyIdentityMiddle() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if session, err := GetSession(c.GetString("Token")); err == nil {
+			server.SetProxyIdentity(c, session.UserId, session.Username)
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/infinit-lab/gravity/config"
+	"github.com/infinit-lab/gravity/server"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type KeyFunc func(c *gin.Context) string
+
+func KeyByIp(c *gin.Context) string {
+	return server.ClientIp(c)
+}
+
+func KeyBySession(c *gin.Context) string {
+	token, ok := c.Get("Token")
+	if !ok {
+		token = c.GetHeader("Authorization")
+		if len(token.(string)) == 0 {
+			token = c.Query("token")
+		}
+	}
+	if session, err := GetSession(token.(string)); err == nil {
+		return "user:" + session.UserId
+	}
+	return "ip:" + server.ClientIp(c)
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type rateLimiter struct {
+	name      string
+	keyFunc   KeyFunc
+	bucketMap map[string]*bucket
+	mutex     sync.Mutex
+	sweepTime time.Time
+}
+
+func RateLimitMiddle(name string, keyFunc KeyFunc) gin.HandlerFunc {
+	if keyFunc == nil {
+		keyFunc = KeyByIp
+	}
+	l := new(rateLimiter)
+	l.name = name
+	l.keyFunc = keyFunc
+	l.bucketMap = make(map[string]*bucket)
+	l.sweepTime = time.Now()
+	return l.handle
+}
+
+func (l *rateLimiter) limit() (float64, int) {
+	rate := config.GetFloat64("ratelimit." + l.name + ".rate")
+	burst := config.GetInt("ratelimit." + l.name + ".burst")
+	if rate <= 0 {
+		rate = config.GetFloat64("ratelimit.default.rate")
+		burst = config.GetInt("ratelimit.default.burst")
+	}
+	if burst <= 0 {
+		burst = int(math.Ceil(rate))
+	}
+	return rate, burst
+}
+
+func (l *rateLimiter) handle(c *gin.Context) {
+	rate, burst := l.limit()
+	if rate <= 0 {
+		c.Next()
+		return
+	}
+	wait, ok := l.take(l.keyFunc(c), rate, burst)
+	if ok {
+		c.Next()
+		return
+	}
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	response := Response{
+		Result: false,
+		Error:  "Too Many Requests",
+	}
+	c.JSON(http.StatusTooManyRequests, response)
+	c.Abort()
+}
+
+func (l *rateLimiter) take(key string, rate float64, burst int) (time.Duration, bool) {
+	now := time.Now()
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	full := time.Duration(float64(burst) / rate * float64(time.Second))
+	if now.Sub(l.sweepTime) > full && now.Sub(l.sweepTime) > time.Minute {
+		for k, b := range l.bucketMap {
+			if now.Sub(b.last) > full {
+				delete(l.bucketMap, k)
+			}
+		}
+		l.sweepTime = now
+	}
+
+	b, ok := l.bucketMap[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), last: now}
+		l.bucketMap[key] = b
+	}
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	return time.Duration((1 - b.tokens) / rate * float64(time.Second)), false
+}
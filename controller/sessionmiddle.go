@@ -13,10 +13,11 @@ func SessionMiddle() gin.HandlerFunc {
 		}
 
 		if len(token) != 0 {
-			_, err := GetSession(token)
+			session, err := GetSession(token)
 			if err == nil {
 				UpdateSession(token)
 				c.Set("Token", token)
+				c.Set("Username", session.Username)
 				c.Next()
 				return
 			}
@@ -0,0 +1,30 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+)
+
+func PingCheck(db Database) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	}
+}
+
+func DiskSpaceCheck(path string, minFree uint64) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		dir, err := filepath.Abs(filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		free, err := freeDiskSpace(dir)
+		if err != nil {
+			return err
+		}
+		if free < minFree {
+			return fmt.Errorf("Free disk space of %s is %d bytes, less than %d bytes. ", dir, free, minFree)
+		}
+		return nil
+	}
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"github.com/infinit-lab/gravity/config"
@@ -26,6 +27,7 @@ type Tx interface {
 	Commit() error
 	Rollback() error
 	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
 }
 
 type Database interface {
@@ -33,6 +35,8 @@ type Database interface {
 	Prepare(query string) (stmt *sql.Stmt, err error)
 	Exec(query string, args ...interface{}) (result sql.Result, err error)
 	Query(query string, args ...interface{}) (rows *sql.Rows, err error)
+	Ping() error
+	PingContext(ctx context.Context) error
 	Close()
 
 	NewTable(content interface{}, tableName string) (table Table, err error)
@@ -44,10 +48,13 @@ type Table interface {
 
 	GetList(whereSql string, args ...interface{}) (values []interface{}, err error)
 	Get(whereSql string, args ...interface{}) (values interface{}, err error)
+	GetTx(tx Tx, whereSql string, args ...interface{}) (value interface{}, err error)
 	Create(data interface{}) (sql.Result, error)
 	CreateSql(data interface{}) (string, []interface{}, error)
 	Update(data interface{}, whereSql string, args ...interface{}) (sql.Result, error)
+	UpdateSql(data interface{}, whereSql string, args ...interface{}) (string, []interface{}, error)
 	Delete(whereSql string, args ...interface{}) (sql.Result, error)
+	DeleteSql(whereSql string, args ...interface{}) (string, []interface{})
 }
 
 func NewDatabase(driverName string, dataSourceName string) (Database, error) {
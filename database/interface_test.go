@@ -1,8 +1,10 @@
 package database
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/infinit-lab/gravity/printer"
+	"math"
 	"testing"
 )
 
@@ -119,6 +121,26 @@ func TestTable_Create(t *testing.T) {
 	printer.Trace(string(data))
 }
 
+func TestDatabase_Ping(t *testing.T) {
+	if err := PingCheck(db)(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := PingCheck(db)(ctx); err == nil {
+		t.Fatal("Ping with a cancelled context should fail. ")
+	}
+	if err := DiskSpaceCheck("test.db", 1)(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := DiskSpaceCheck("test.db", math.MaxUint64)(context.Background()); err == nil {
+		t.Fatal("Disk space check should fail. ")
+	}
+}
+
 func TestDatabase_Close(t *testing.T) {
 	db.Close()
+	if err := db.Ping(); err == nil {
+		t.Fatal("Ping should fail after close. ")
+	}
 }
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"github.com/infinit-lab/gravity/printer"
@@ -70,6 +71,20 @@ func (m *mysql) Query(query string, args ...interface{}) (*sql.Rows, error) {
 	return row, err
 }
 
+func (m *mysql) Ping() error {
+	return m.PingContext(context.Background())
+}
+
+func (m *mysql) PingContext(ctx context.Context) error {
+	m.mutex.Lock()
+	db := m.db
+	m.mutex.Unlock()
+	if db == nil {
+		return errors.New("The mysql is nil. ")
+	}
+	return db.PingContext(ctx)
+}
+
 func (m *mysql) Close() {
 	m.isRunning = false
 }
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"github.com/infinit-lab/gravity/printer"
@@ -38,6 +39,15 @@ func (tx *sqliteTx) Exec(query string, args ...interface{}) (sql.Result, error)
 	return result, err
 }
 
+func (tx *sqliteTx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	rows, err := tx.tx.Query(query, args...)
+	if err != nil {
+		printer.Error(err)
+		printer.Error(query, args)
+	}
+	return rows, err
+}
+
 func (d *sqlite) Begin() (Tx, error) {
 	d.mutex.Lock()
 	if d.db == nil {
@@ -95,6 +105,19 @@ func (d *sqlite) Query(query string, args ...interface{}) (rows *sql.Rows, err e
 	return
 }
 
+func (d *sqlite) Ping() error {
+	return d.PingContext(context.Background())
+}
+
+func (d *sqlite) PingContext(ctx context.Context) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.db == nil {
+		return errors.New("The sqlite is nil. ")
+	}
+	return d.db.PingContext(ctx)
+}
+
 func (d *sqlite) Close() {
 	d.mutex.Lock()
 	defer d.mutex.Unlock()
@@ -24,6 +24,10 @@ func (t *table) TableName() string {
 }
 
 func (t *table) GetList(whereSql string, args ...interface{}) (values []interface{}, err error) {
+	return t.getList(t.db.Query, whereSql, args...)
+}
+
+func (t *table) getList(queryFunc func(query string, args ...interface{}) (*sql.Rows, error), whereSql string, args ...interface{}) (values []interface{}, err error) {
 	fields, err := parseStructWithOmit(t.template, "get")
 	query := "SELECT "
 	for i, f := range fields {
@@ -34,7 +38,7 @@ func (t *table) GetList(whereSql string, args ...interface{}) (values []interfac
 	}
 	query += " FROM " + t.tableName + " "
 	query += whereSql
-	rows, err := t.db.Query(query, args...)
+	rows, err := queryFunc(query, args...)
 	if err != nil {
 		printer.Error(err)
 		return nil, err
@@ -93,6 +97,21 @@ func (t *table) Get(whereSql string, args ...interface{}) (value interface{}, er
 	return values[0], nil
 }
 
+func (t *table) GetTx(tx Tx, whereSql string, args ...interface{}) (value interface{}, err error) {
+	if tx == nil {
+		return nil, errors.New("The transaction is nil. ")
+	}
+	values, err := t.getList(tx.Query, whereSql, args...)
+	if err != nil {
+		printer.Error(err)
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, errors.New("Not found. ")
+	}
+	return values[0], nil
+}
+
 func (t *table) Create(data interface{}) (sql.Result, error) {
 	fields, err := parseStructWithOmit(data, "create")
 	if err != nil {
@@ -147,10 +166,19 @@ func (t *table) CreateSql(data interface{}) (string, []interface{}, error) {
 }
 
 func (t *table) Update(data interface{}, whereSql string, args ...interface{}) (sql.Result, error) {
+	query, values, err := t.UpdateSql(data, whereSql, args...)
+	if err != nil {
+		return nil, err
+	}
+	ret, err := t.db.Exec(query, values...)
+	return ret, err
+}
+
+func (t *table) UpdateSql(data interface{}, whereSql string, args ...interface{}) (string, []interface{}, error) {
 	fields, err := parseStructWithOmit(data, "update")
 	if err != nil {
 		printer.Trace(err)
-		return nil, err
+		return "", nil, err
 	}
 	var values []interface{}
 	query := "UPDATE " + t.tableName + " SET "
@@ -163,15 +191,19 @@ func (t *table) Update(data interface{}, whereSql string, args ...interface{}) (
 	}
 	query += whereSql
 	values = append(values, args...)
+	return query, values, nil
+}
+
+func (t *table) Delete(whereSql string, args ...interface{}) (sql.Result, error) {
+	query, values := t.DeleteSql(whereSql, args...)
 	ret, err := t.db.Exec(query, values...)
 	return ret, err
 }
 
-func (t *table) Delete(whereSql string, args ...interface{}) (sql.Result, error) {
+func (t *table) DeleteSql(whereSql string, args ...interface{}) (string, []interface{}) {
 	query := "DELETE FROM " + t.tableName + " "
 	query += whereSql
-	ret, err := t.db.Exec(query, args...)
-	return ret, err
+	return query, args
 }
 
 func parseStructWithOmit(data interface{}, omit string) ([]*field, error) {
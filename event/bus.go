@@ -0,0 +1,52 @@
+package event
+
+import (
+	"github.com/infinit-lab/gravity/database"
+	"sync"
+)
+
+type Bus struct {
+	subscriberMap   map[string][]Subscriber
+	subscriberMutex sync.Mutex
+	publishMap      map[string]*publishStats
+	journal         *journal
+	journalMutex    sync.Mutex
+
+	syncHandlerList  []*syncHandler
+	syncHandlerIndex int
+	syncHandlerMutex sync.Mutex
+
+	responderList  []*responder
+	responderIndex int
+	responderMutex sync.Mutex
+	pendingMap     map[string]chan *reply
+	pendingMutex   sync.Mutex
+
+	scheduleTable database.Table
+	scheduleMutex sync.Mutex
+
+	handlerMap      map[string]*funcHandler
+	handlerMutex    sync.Mutex
+	deadLetterList  []*DeadLetter
+	deadLetterIndex int64
+	deadLetterMutex sync.Mutex
+}
+
+func NewBus() *Bus {
+	b := new(Bus)
+	b.subscriberMap = make(map[string][]Subscriber)
+	b.publishMap = make(map[string]*publishStats)
+	b.pendingMap = make(map[string]chan *reply)
+	b.handlerMap = make(map[string]*funcHandler)
+	return b
+}
+
+func Default() *Bus {
+	return defaultBus
+}
+
+var defaultBus *Bus
+
+func init() {
+	defaultBus = NewBus()
+}
@@ -0,0 +1,185 @@
+package event
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/infinit-lab/gravity/printer"
+	"reflect"
+	"sync"
+)
+
+var ErrUnknownType = errors.New("Unknown type. ")
+
+func RegisterType(topic string, prototype interface{}) error {
+	if err := checkTopic(topic); err != nil {
+		return err
+	}
+	if prototype == nil {
+		return errors.New("The prototype is nil. ")
+	}
+	t := reflect.TypeOf(prototype)
+
+	typeMutex.Lock()
+	defer typeMutex.Unlock()
+	topicTypeMap[topic] = t
+	nameTypeMap[typeName(t)] = t
+	return nil
+}
+
+func RegisterContextType(prototype interface{}) error {
+	if prototype == nil {
+		return errors.New("The prototype is nil. ")
+	}
+	t := reflect.TypeOf(prototype)
+
+	typeMutex.Lock()
+	defer typeMutex.Unlock()
+	nameTypeMap[typeName(t)] = t
+	return nil
+}
+
+func EncodeData(data interface{}) (string, []byte, error) {
+	if data == nil {
+		return "", nil, nil
+	}
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		return "", nil, err
+	}
+	t := reflect.TypeOf(data)
+	name := typeName(t)
+
+	typeMutex.Lock()
+	defer typeMutex.Unlock()
+	if _, ok := nameTypeMap[name]; !ok {
+		if isNamedType(t) && !warnedTypeMap[name] {
+			warnedTypeMap[name] = true
+			printer.Warning("Type ", name, " is not registered and will be decoded as generic json. ")
+		}
+		return "", bytes, nil
+	}
+	return name, bytes, nil
+}
+
+func DecodeData(topic string, tag string, bytes []byte) (interface{}, error) {
+	if len(bytes) == 0 {
+		return nil, nil
+	}
+	typeMutex.Lock()
+	var t reflect.Type
+	var ok bool
+	if len(tag) != 0 {
+		t, ok = nameTypeMap[tag]
+	} else {
+		t, ok = topicTypeMap[topic]
+	}
+	typeMutex.Unlock()
+
+	if !ok {
+		if len(tag) != 0 {
+			return nil, ErrUnknownType
+		}
+		var data interface{}
+		err := json.Unmarshal(bytes, &data)
+		return data, err
+	}
+	isPtr := t.Kind() == reflect.Ptr
+	if isPtr {
+		t = t.Elem()
+	}
+	value := reflect.New(t)
+	if err := json.Unmarshal(bytes, value.Interface()); err != nil {
+		return nil, err
+	}
+	if isPtr {
+		return value.Interface(), nil
+	}
+	return value.Elem().Interface(), nil
+}
+
+func DecodeContext(tag string, bytes []byte) (interface{}, error) {
+	return DecodeData("", tag, bytes)
+}
+
+func Marshal(event *Event) ([]byte, error) {
+	if event == nil {
+		return nil, errors.New("The event is nil. ")
+	}
+	e := new(envelope)
+	e.Id = event.Id
+	e.Sequence = event.Sequence
+	e.Topic = event.Topic
+	e.Status = event.Status
+	var err error
+	e.Type, e.Data, err = EncodeData(event.Data)
+	if err != nil {
+		return nil, err
+	}
+	e.ContextType, e.Context, err = EncodeData(event.Context)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(e)
+}
+
+func Unmarshal(bytes []byte) (*Event, error) {
+	e := new(envelope)
+	if err := json.Unmarshal(bytes, e); err != nil {
+		return nil, err
+	}
+	event := new(Event)
+	event.Id = e.Id
+	event.Sequence = e.Sequence
+	event.Topic = e.Topic
+	event.Status = e.Status
+	var err error
+	event.Data, err = DecodeData(e.Topic, e.Type, e.Data)
+	if err != nil {
+		return nil, err
+	}
+	event.Context, err = DecodeContext(e.ContextType, e.Context)
+	if err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+var topicTypeMap map[string]reflect.Type
+var nameTypeMap map[string]reflect.Type
+var warnedTypeMap map[string]bool
+var typeMutex sync.Mutex
+
+func init() {
+	topicTypeMap = make(map[string]reflect.Type)
+	nameTypeMap = make(map[string]reflect.Type)
+	warnedTypeMap = make(map[string]bool)
+}
+
+type envelope struct {
+	Id       string          `json:"id,omitempty"`
+	Sequence int64           `json:"sequence,omitempty"`
+	Topic    string          `json:"topic"`
+	Status   string          `json:"status"`
+	Type     string          `json:"type,omitempty"`
+	Data     json.RawMessage `json:"data,omitempty"`
+
+	ContextType string          `json:"contextType,omitempty"`
+	Context     json.RawMessage `json:"context,omitempty"`
+}
+
+func typeName(t reflect.Type) string {
+	if t.Kind() == reflect.Ptr {
+		return "*" + typeName(t.Elem())
+	}
+	if len(t.PkgPath()) == 0 {
+		return t.String()
+	}
+	return t.PkgPath() + "." + t.Name()
+}
+
+func isNamedType(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return len(t.PkgPath()) != 0
+}
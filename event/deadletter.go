@@ -0,0 +1,238 @@
+package event
+
+import (
+	"errors"
+	"fmt"
+	"github.com/infinit-lab/gravity/printer"
+	"time"
+)
+
+const (
+	TopicDeadLetter  string = "event.deadletter"
+	StatusDeadLetter string = "failed"
+	maxDeadLetters   int    = 1000
+)
+
+type HandlerFunc func(e *Event) error
+
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration
+}
+
+type HandlerOptions struct {
+	Options
+	Retry RetryPolicy
+}
+
+type Handler interface {
+	Name() string
+	Unsubscribe()
+	Dropped() int64
+	Pending() int
+}
+
+type DeadLetter struct {
+	Id         int64  `json:"id"`
+	Event      *Event `json:"event"`
+	Subscriber string `json:"subscriber"`
+	Error      string `json:"error"`
+	Attempts   int    `json:"attempts"`
+	Time       string `json:"time"`
+}
+
+func SubscribeFunc(topic string, name string, handler HandlerFunc, options HandlerOptions) (Handler, error) {
+	return defaultBus.SubscribeFunc(topic, name, handler, options)
+}
+
+func DeadLetters() []*DeadLetter {
+	return defaultBus.DeadLetters()
+}
+
+func ReplayDeadLetter(id int64) error {
+	return defaultBus.ReplayDeadLetter(id)
+}
+
+func RemoveDeadLetter(id int64) {
+	defaultBus.RemoveDeadLetter(id)
+}
+
+func (b *Bus) SubscribeFunc(topic string, name string, handler HandlerFunc, options HandlerOptions) (Handler, error) {
+	if len(name) == 0 {
+		return nil, errors.New("Name is empty. ")
+	}
+	if handler == nil {
+		return nil, errors.New("The handler is nil. ")
+	}
+	if options.Retry.MaxAttempts <= 0 {
+		options.Retry.MaxAttempts = 1
+	}
+
+	b.handlerMutex.Lock()
+	defer b.handlerMutex.Unlock()
+	if _, ok := b.handlerMap[name]; ok {
+		return nil, errors.New("Name is conflicted. ")
+	}
+	s, err := b.SubscribeWithOptions(topic, options.Options)
+	if err != nil {
+		return nil, err
+	}
+	h := new(funcHandler)
+	h.bus = b
+	h.name = name
+	h.handler = handler
+	h.retry = options.Retry
+	h.subscriber = s
+	b.handlerMap[name] = h
+	go h.loop()
+	return h, nil
+}
+
+func (b *Bus) DeadLetters() []*DeadLetter {
+	b.deadLetterMutex.Lock()
+	defer b.deadLetterMutex.Unlock()
+	list := make([]*DeadLetter, len(b.deadLetterList))
+	copy(list, b.deadLetterList)
+	return list
+}
+
+func (b *Bus) ReplayDeadLetter(id int64) error {
+	letter, ok := b.getDeadLetter(id)
+	if !ok {
+		return errors.New("Dead letter is not found. ")
+	}
+	b.handlerMutex.Lock()
+	h, ok := b.handlerMap[letter.Subscriber]
+	b.handlerMutex.Unlock()
+	if !ok {
+		return errors.New("Subscriber " + letter.Subscriber + " is not found. ")
+	}
+	if _, err := h.handle(letter.Event); err != nil {
+		return err
+	}
+	b.RemoveDeadLetter(id)
+	return nil
+}
+
+func (b *Bus) RemoveDeadLetter(id int64) {
+	b.deadLetterMutex.Lock()
+	defer b.deadLetterMutex.Unlock()
+	for i, letter := range b.deadLetterList {
+		if letter.Id == id {
+			b.deadLetterList = append(b.deadLetterList[:i:i], b.deadLetterList[i+1:]...)
+			break
+		}
+	}
+}
+
+func (b *Bus) getDeadLetter(id int64) (*DeadLetter, bool) {
+	b.deadLetterMutex.Lock()
+	defer b.deadLetterMutex.Unlock()
+	for _, letter := range b.deadLetterList {
+		if letter.Id == id {
+			return letter, true
+		}
+	}
+	return nil, false
+}
+
+func (b *Bus) addDeadLetter(name string, event *Event, err error, attempts int) {
+	printer.Error("Subscriber ", name, " failed to handle event ", event.Topic, ". error: ", err)
+	if event.Topic == TopicDeadLetter {
+		return
+	}
+	letter := new(DeadLetter)
+	letter.Event = event
+	letter.Subscriber = name
+	letter.Error = err.Error()
+	letter.Attempts = attempts
+	letter.Time = time.Now().Format("2006-01-02 15:04:05")
+
+	b.deadLetterMutex.Lock()
+	b.deadLetterIndex++
+	letter.Id = b.deadLetterIndex
+	b.deadLetterList = append(b.deadLetterList, letter)
+	if len(b.deadLetterList) > maxDeadLetters {
+		b.deadLetterList = b.deadLetterList[len(b.deadLetterList)-maxDeadLetters:]
+	}
+	b.deadLetterMutex.Unlock()
+
+	e := new(Event)
+	e.Topic = TopicDeadLetter
+	e.Status = StatusDeadLetter
+	e.Data = letter
+	if err := b.Publish(e); err != nil {
+		printer.Error(err)
+	}
+}
+
+type funcHandler struct {
+	bus        *Bus
+	name       string
+	handler    HandlerFunc
+	retry      RetryPolicy
+	subscriber Subscriber
+}
+
+func (h *funcHandler) Name() string {
+	return h.name
+}
+
+func (h *funcHandler) Unsubscribe() {
+	h.bus.handlerMutex.Lock()
+	if h.bus.handlerMap[h.name] == h {
+		delete(h.bus.handlerMap, h.name)
+	}
+	h.bus.handlerMutex.Unlock()
+	h.subscriber.Unsubscribe()
+}
+
+func (h *funcHandler) Dropped() int64 {
+	if d, ok := h.subscriber.(DropCounter); ok {
+		return d.Dropped()
+	}
+	return 0
+}
+
+func (h *funcHandler) Pending() int {
+	if p, ok := h.subscriber.(PendingCounter); ok {
+		return p.Pending()
+	}
+	return 0
+}
+
+func (h *funcHandler) call(event *Event) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("Handler panic: %v. ", e)
+		}
+	}()
+	return h.handler(event)
+}
+
+func (h *funcHandler) handle(event *Event) (int, error) {
+	var err error
+	attempts := 0
+	for attempts < h.retry.MaxAttempts {
+		if attempts != 0 && h.retry.Backoff > 0 {
+			time.Sleep(h.retry.Backoff)
+		}
+		attempts++
+		if err = h.call(event); err == nil {
+			return attempts, nil
+		}
+	}
+	return attempts, err
+}
+
+func (h *funcHandler) loop() {
+	for {
+		event, ok := <-h.subscriber.Event()
+		if !ok {
+			return
+		}
+		if attempts, err := h.handle(event); err != nil {
+			h.bus.addDeadLetter(h.name, event, err, attempts)
+		}
+	}
+}
@@ -1,16 +1,21 @@
 package event
 
 import (
+	"context"
 	"errors"
 	"github.com/infinit-lab/gravity/printer"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Event struct {
-	Topic   string      `json:"topic"`
-	Status  string      `json:"status"`
-	Data    interface{} `json:"data,omitempty"`
-	Context interface{} `json:"context,omitempty"`
+	Id       string      `json:"id,omitempty"`
+	Sequence int64       `json:"sequence,omitempty"`
+	Topic    string      `json:"topic"`
+	Status   string      `json:"status"`
+	Data     interface{} `json:"data,omitempty"`
+	Context  interface{} `json:"context,omitempty"`
 }
 
 type Subscriber interface {
@@ -18,97 +23,323 @@ type Subscriber interface {
 	Unsubscribe()
 }
 
+type DropCounter interface {
+	Dropped() int64
+}
+
+type PendingCounter interface {
+	Pending() int
+}
+
+const (
+	PolicyBlock      int = 0
+	PolicyDropNewest int = 1
+	PolicyDropOldest int = 2
+)
+
+const (
+	DefaultTimeout  time.Duration = 5 * time.Second
+	DefaultMaxQueue int           = 1024
+)
+
+type Options struct {
+	BufferSize int
+	Policy     int
+	Timeout    time.Duration
+	MaxQueue   int
+	Status     []string
+	Filter     func(e *Event) bool
+}
+
 func Subscribe(topic string) (Subscriber, error) {
-	s := new(subscriber)
-	s.c = make(chan *Event)
-	s.topic = topic
+	return defaultBus.Subscribe(topic)
+}
 
-	subscriberMutex.Lock()
-	defer subscriberMutex.Unlock()
+func SubscribeWithOptions(topic string, options Options) (Subscriber, error) {
+	return defaultBus.SubscribeWithOptions(topic, options)
+}
 
-	list := subscriberMap[topic]
-	list = append(list, s)
-	subscriberMap[topic] = list
-	return s, nil
+func SubscribeContext(ctx context.Context, topic string) (Subscriber, error) {
+	return defaultBus.SubscribeContext(ctx, topic)
+}
+
+func SubscribeContextWithOptions(ctx context.Context, topic string, options Options) (Subscriber, error) {
+	return defaultBus.SubscribeContextWithOptions(ctx, topic, options)
 }
 
 func SubscribeAll() (Subscriber, error) {
-	return Subscribe("")
+	return defaultBus.SubscribeAll()
 }
 
 func Publish(event *Event) error {
+	return defaultBus.Publish(event)
+}
+
+func (b *Bus) Subscribe(topic string) (Subscriber, error) {
+	return b.SubscribeWithOptions(topic, Options{})
+}
+
+func (b *Bus) SubscribeWithOptions(topic string, options Options) (Subscriber, error) {
+	if err := checkPattern(topic); err != nil {
+		return nil, err
+	}
+	s, err := b.newSubscriber(topic, options)
+	if err != nil {
+		return nil, err
+	}
+
+	b.subscriberMutex.Lock()
+	defer b.subscriberMutex.Unlock()
+
+	list := b.subscriberMap[topic]
+	list = append(list, s)
+	b.subscriberMap[topic] = list
+	return s, nil
+}
+
+func (b *Bus) SubscribeContext(ctx context.Context, topic string) (Subscriber, error) {
+	return b.SubscribeContextWithOptions(ctx, topic, Options{})
+}
+
+func (b *Bus) SubscribeContextWithOptions(ctx context.Context, topic string, options Options) (Subscriber, error) {
+	if ctx == nil {
+		return nil, errors.New("The context is nil. ")
+	}
+	temp, err := b.SubscribeWithOptions(topic, options)
+	if err != nil {
+		return nil, err
+	}
+	s := temp.(*subscriber)
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Unsubscribe()
+		case <-s.closeChan:
+		}
+	}()
+	return s, nil
+}
+
+func (b *Bus) SubscribeAll() (Subscriber, error) {
+	return b.Subscribe("")
+}
+
+func (b *Bus) Publish(event *Event) error {
 	if event == nil {
 		return errors.New("The event is nil. ")
 	}
 
-	if len(event.Topic) == 0 {
-		return errors.New("Topic is empty. ")
+	if err := checkTopic(event.Topic); err != nil {
+		return err
 	}
 
-	subscriberMutex.Lock()
-	defer subscriberMutex.Unlock()
+	b.journalMutex.Lock()
+	defer b.journalMutex.Unlock()
+	var err error
+	if b.journal != nil {
+		if err = b.journal.append(event); err != nil {
+			printer.Error(err)
+		}
+	}
 
-	publish(event.Topic, event)
-	publish("", event)
-	return nil
+	b.subscriberMutex.Lock()
+	defer b.subscriberMutex.Unlock()
+
+	b.countPublish(event.Topic)
+	for pattern := range b.subscriberMap {
+		if MatchTopic(pattern, event.Topic) {
+			b.publish(pattern, event)
+		}
+	}
+	return err
 }
 
-var subscriberMap map[string][]Subscriber
-var subscriberMutex sync.Mutex
+func (b *Bus) newSubscriber(topic string, options Options) (*subscriber, error) {
+	if options.BufferSize < 0 {
+		return nil, errors.New("The buffer size is negative. ")
+	}
+	switch options.Policy {
+	case PolicyBlock:
+	case PolicyDropNewest, PolicyDropOldest:
+		if options.BufferSize == 0 {
+			options.BufferSize = 1
+		}
+	default:
+		return nil, errors.New("Unknown policy. ")
+	}
+	if options.Timeout == 0 {
+		options.Timeout = DefaultTimeout
+	}
+	if options.MaxQueue < 0 {
+		return nil, errors.New("The max queue is negative. ")
+	}
+	if options.MaxQueue == 0 {
+		options.MaxQueue = DefaultMaxQueue
+	}
 
-func init() {
-	subscriberMap = make(map[string][]Subscriber)
+	s := new(subscriber)
+	s.bus = b
+	s.c = make(chan *Event, options.BufferSize)
+	s.topic = topic
+	s.options = options
+	s.closeChan = make(chan int)
+	return s, nil
 }
 
 type subscriber struct {
-	c     chan *Event
-	topic string
+	bus        *Bus
+	c          chan *Event
+	topic      string
+	options    Options
+	dropped    int64
+	queue      []*Event
+	queueMutex sync.Mutex
+	isPumping  bool
+	pumpGroup  sync.WaitGroup
+	closeChan  chan int
+	closeOnce  sync.Once
+	isRemoved  bool
 }
 
 func (s *subscriber) Event() <-chan *Event {
 	return s.c
 }
 
+func (s *subscriber) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
+
+func (s *subscriber) Pending() int {
+	s.queueMutex.Lock()
+	defer s.queueMutex.Unlock()
+	return len(s.c) + len(s.queue)
+}
+
 func (s *subscriber) Unsubscribe() {
-	subscriberMutex.Lock()
-	defer func() {
+	s.closeOnce.Do(func() {
+		s.bus.subscriberMutex.Lock()
+		s.isRemoved = true
+		subscriberList := s.bus.subscriberMap[s.topic]
+		for i, subscriber := range subscriberList {
+			if subscriber == s {
+				var list []Subscriber
+				list = append(list, subscriberList[0:i]...)
+				if i+1 < len(subscriberList) {
+					list = append(list, subscriberList[i+1:]...)
+				}
+				s.bus.subscriberMap[s.topic] = list
+				break
+			}
+		}
+		s.bus.subscriberMutex.Unlock()
+
+		close(s.closeChan)
+		s.pumpGroup.Wait()
 		close(s.c)
-		subscriberMutex.Unlock()
-	}()
+	})
+}
+
+func (s *subscriber) accept(event *Event) bool {
+	if len(s.options.Status) != 0 && !MatchStatus(s.options.Status...)(event) {
+		return false
+	}
+	if s.options.Filter != nil && !s.options.Filter(event) {
+		return false
+	}
+	return true
+}
 
-	subscriberList, ok := subscriberMap[s.topic]
-	if !ok {
+func (s *subscriber) deliver(event *Event) {
+	if !s.accept(event) {
 		return
 	}
-	for i, subscriber := range subscriberList {
-		if subscriber == s {
-			var list []Subscriber
-			list = append(list, subscriberList[0:i]...)
-			if i+1 < len(subscriberList) {
-				list = append(list, subscriberList[i+1:]...)
+	switch s.options.Policy {
+	case PolicyDropNewest:
+		select {
+		case s.c <- event:
+		default:
+			atomic.AddInt64(&s.dropped, 1)
+		}
+	case PolicyDropOldest:
+		for {
+			select {
+			case s.c <- event:
+				return
+			default:
 			}
-			subscriberMap[s.topic] = list
-			break
+			select {
+			case <-s.c:
+				atomic.AddInt64(&s.dropped, 1)
+			default:
+			}
+		}
+	default:
+		s.queueMutex.Lock()
+		defer s.queueMutex.Unlock()
+		if !s.isPumping {
+			select {
+			case s.c <- event:
+				return
+			default:
+			}
+			s.isPumping = true
+			s.pumpGroup.Add(1)
+			go s.pump()
 		}
+		if len(s.queue) >= s.options.MaxQueue {
+			atomic.AddInt64(&s.dropped, 1)
+			return
+		}
+		s.queue = append(s.queue, event)
 	}
 }
 
-func publish(topic string, event *Event) {
-	list, ok := subscriberMap[topic]
+func (s *subscriber) pump() {
+	defer s.pumpGroup.Done()
+	for {
+		s.queueMutex.Lock()
+		if len(s.queue) == 0 {
+			s.isPumping = false
+			s.queueMutex.Unlock()
+			return
+		}
+		event := s.queue[0]
+		s.queue[0] = nil
+		s.queue = s.queue[1:]
+		s.queueMutex.Unlock()
+
+		var timer *time.Timer
+		var timeoutChan <-chan time.Time
+		if s.options.Timeout > 0 {
+			timer = time.NewTimer(s.options.Timeout)
+			timeoutChan = timer.C
+		}
+		select {
+		case s.c <- event:
+		case <-timeoutChan:
+			atomic.AddInt64(&s.dropped, 1)
+		case <-s.closeChan:
+			s.queueMutex.Lock()
+			s.queue = nil
+			s.isPumping = false
+			s.queueMutex.Unlock()
+			return
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+func (b *Bus) publish(topic string, event *Event) {
+	list, ok := b.subscriberMap[topic]
 	if ok {
-		go func() {
-			defer func() {
-				if err := recover(); err != nil {
-					printer.Error(err)
-				}
-			}()
-			for _, s := range list {
-				temp, ok := s.(*subscriber)
-				if !ok {
-					continue
-				}
-				temp.c <- event
+		for _, s := range list {
+			temp, ok := s.(*subscriber)
+			if !ok {
+				continue
 			}
-		}()
+			temp.deliver(event)
+		}
 	}
 }
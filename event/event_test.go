@@ -1,7 +1,10 @@
 package event
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"github.com/infinit-lab/gravity/database"
 	"log"
 	"sync"
 	"testing"
@@ -93,3 +96,656 @@ func TestEvent(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestSubscribeWithOptions(t *testing.T) {
+	newest, err := SubscribeWithOptions("options", Options{BufferSize: 2, Policy: PolicyDropNewest})
+	if err != nil {
+		t.Fatal("Failed to SubscribeWithOptions. error: ", err)
+	}
+	defer newest.Unsubscribe()
+	oldest, err := SubscribeWithOptions("options", Options{BufferSize: 2, Policy: PolicyDropOldest})
+	if err != nil {
+		t.Fatal("Failed to SubscribeWithOptions. error: ", err)
+	}
+	defer oldest.Unsubscribe()
+	block, err := SubscribeWithOptions("options", Options{Timeout: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal("Failed to SubscribeWithOptions. error: ", err)
+	}
+	defer block.Unsubscribe()
+
+	for i := 0; i < 3; i++ {
+		_ = Publish(&Event{Topic: "options", Data: i})
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	if newest.(DropCounter).Dropped() != 1 {
+		t.Fatal("Dropped of newest should be 1, not ", newest.(DropCounter).Dropped())
+	}
+	if e := <-newest.Event(); e.Data != 0 {
+		t.Fatal("The first event of newest should be 0, not ", e.Data)
+	}
+	if oldest.(DropCounter).Dropped() != 1 {
+		t.Fatal("Dropped of oldest should be 1, not ", oldest.(DropCounter).Dropped())
+	}
+	if e := <-oldest.Event(); e.Data != 1 {
+		t.Fatal("The first event of oldest should be 1, not ", e.Data)
+	}
+	if block.(DropCounter).Dropped() != 3 {
+		t.Fatal("Dropped of block should be 3, not ", block.(DropCounter).Dropped())
+	}
+
+	if _, err := SubscribeWithOptions("options", Options{Policy: 10}); err == nil {
+		t.Fatal("Unknown policy should be rejected. ")
+	}
+	def, err := Subscribe("options.default")
+	if err != nil {
+		t.Fatal("Failed to Subscribe. error: ", err)
+	}
+	defer def.Unsubscribe()
+	if def.(*subscriber).options.Timeout != DefaultTimeout {
+		t.Fatal("Block policy should wait DefaultTimeout by default. ")
+	}
+	for i := 0; i < DefaultMaxQueue+100; i++ {
+		_ = Publish(&Event{Topic: "options.default", Data: i})
+	}
+	if def.(PendingCounter).Pending() > DefaultMaxQueue {
+		t.Fatal("Pending of a stuck subscriber should be capped, not ", def.(PendingCounter).Pending())
+	}
+	if def.(DropCounter).Dropped() < 99 {
+		t.Fatal("Overflow should be counted as dropped, not ", def.(DropCounter).Dropped())
+	}
+}
+
+func TestOrderedDelivery(t *testing.T) {
+	s, err := Subscribe("order")
+	if err != nil {
+		t.Fatal("Failed to Subscribe. error: ", err)
+	}
+	defer s.Unsubscribe()
+
+	const count = 1000
+	go func() {
+		for i := 0; i < count; i++ {
+			_ = Publish(&Event{Topic: "order", Data: i})
+		}
+	}()
+	for i := 0; i < count; i++ {
+		e := <-s.Event()
+		if e.Data != i {
+			t.Fatal("Event ", i, " is out of order, got ", e.Data)
+		}
+	}
+}
+
+func TestWildcardSubscribe(t *testing.T) {
+	single, err := Subscribe("auth.*")
+	if err != nil {
+		t.Fatal("Failed to Subscribe. error: ", err)
+	}
+	defer single.Unsubscribe()
+	multi, err := SubscribeWithOptions("auth.#", Options{BufferSize: 10, Status: []string{"created"}})
+	if err != nil {
+		t.Fatal("Failed to SubscribeWithOptions. error: ", err)
+	}
+	defer multi.Unsubscribe()
+
+	if _, err := Subscribe("auth.us*"); err == nil {
+		t.Fatal("Partial wildcard should be rejected. ")
+	}
+	if err := Publish(&Event{Topic: "auth.*"}); err == nil {
+		t.Fatal("Publishing to wildcard topic should be rejected. ")
+	}
+
+	_ = Publish(&Event{Topic: "auth.user", Status: "created"})
+	_ = Publish(&Event{Topic: "auth.user.role", Status: "updated"})
+	_ = Publish(&Event{Topic: "auth.user.role", Status: "created"})
+	_ = Publish(&Event{Topic: "auth", Status: "created"})
+	_ = Publish(&Event{Topic: "session", Status: "created"})
+
+	if e := <-single.Event(); e.Topic != "auth.user" {
+		t.Fatal("Unexpected event ", e.Topic)
+	}
+	var topics []string
+	for i := 0; i < 3; i++ {
+		e := <-multi.Event()
+		topics = append(topics, e.Topic)
+	}
+	if topics[0] != "auth.user" || topics[1] != "auth.user.role" || topics[2] != "auth" {
+		t.Fatal("Unexpected events ", topics)
+	}
+	time.Sleep(10 * time.Millisecond)
+	select {
+	case e := <-single.Event():
+		t.Fatal("Unexpected event ", e.Topic)
+	case e := <-multi.Event():
+		t.Fatal("Unexpected event ", e.Topic)
+	default:
+	}
+}
+
+func TestPublishSync(t *testing.T) {
+	var calls []string
+	low, err := RegisterSyncHandler("sync.#", 1, func(e *Event) error {
+		calls = append(calls, "low")
+		return errors.New("low failed. ")
+	})
+	if err != nil {
+		t.Fatal("Failed to RegisterSyncHandler. error: ", err)
+	}
+	defer low.Unregister()
+	high, err := RegisterSyncHandler("sync.test", 10, func(e *Event) error {
+		calls = append(calls, "high")
+		if e.Status == "veto" {
+			return Veto(errors.New("Not allowed. "))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal("Failed to RegisterSyncHandler. error: ", err)
+	}
+	defer high.Unregister()
+
+	err = PublishSync(&Event{Topic: "sync.test", Status: "check"})
+	if _, ok := err.(*SyncError); !ok || IsVeto(err) {
+		t.Fatal("PublishSync should return SyncError, not ", err)
+	}
+	if len(calls) != 2 || calls[0] != "high" || calls[1] != "low" {
+		t.Fatal("Handlers are called out of priority order ", calls)
+	}
+
+	calls = nil
+	err = PublishSync(&Event{Topic: "sync.test", Status: "veto"})
+	if !IsVeto(err) {
+		t.Fatal("PublishSync should be vetoed, not ", err)
+	}
+	if len(calls) != 1 {
+		t.Fatal("Handlers after veto should not be called ", calls)
+	}
+
+	low.Unregister()
+	high.Unregister()
+	if err := PublishSync(&Event{Topic: "sync.test"}); err != nil {
+		t.Fatal("PublishSync without handlers should succeed, not ", err)
+	}
+}
+
+func TestRequest(t *testing.T) {
+	if _, err := Request("query.sum", nil, time.Second); err != ErrNoResponder {
+		t.Fatal("Request without responder should fail with ErrNoResponder, not ", err)
+	}
+
+	r, err := Respond("query.*", func(request *Event) (interface{}, error) {
+		switch request.Topic {
+		case "query.sum":
+			sum := 0
+			for _, v := range request.Data.([]int) {
+				sum += v
+			}
+			return sum, nil
+		case "query.slow":
+			time.Sleep(100 * time.Millisecond)
+			return nil, nil
+		}
+		return nil, errors.New("Unknown query. ")
+	})
+	if err != nil {
+		t.Fatal("Failed to Respond. error: ", err)
+	}
+	defer r.Unregister()
+
+	reply, err := Request("query.sum", []int{1, 2, 3}, time.Second)
+	if err != nil {
+		t.Fatal("Failed to Request. error: ", err)
+	}
+	if reply.Status != StatusReply || reply.Data != 6 || len(reply.Id) == 0 {
+		t.Fatal("Unexpected reply ", reply)
+	}
+	if _, err := Request("query.unknown", nil, time.Second); err == nil {
+		t.Fatal("Error of responder should be returned. ")
+	}
+	if _, err := Request("query.slow", nil, 10*time.Millisecond); err != ErrTimeout {
+		t.Fatal("Request should time out, not ", err)
+	}
+
+	r.Unregister()
+	if _, err := Request("query.sum", nil, time.Second); err != ErrNoResponder {
+		t.Fatal("Request after Unregister should fail with ErrNoResponder, not ", err)
+	}
+}
+
+func TestJournal(t *testing.T) {
+	db, err := database.NewDatabase("sqlite3", "test.db")
+	if err != nil {
+		t.Fatal("Failed to NewDatabase. error: ", err)
+	}
+	defer db.Close()
+	if err := EnableJournal(db, JournalOptions{MaxCount: 100}); err != nil {
+		t.Fatal("Failed to EnableJournal. error: ", err)
+	}
+	defer DisableJournal()
+
+	first := &Event{Topic: "journal.test", Status: "first", Data: "first"}
+	_ = Publish(first)
+	if first.Sequence == 0 {
+		t.Fatal("Sequence of journaled event should not be zero. ")
+	}
+	_ = Publish(&Event{Topic: "journal.other", Status: "other"})
+	_ = Publish(&Event{Topic: "journal.test", Status: "second", Data: "second"})
+
+	s, err := SubscribeFrom("journal.test", first.Sequence-1)
+	if err != nil {
+		t.Fatal("Failed to SubscribeFrom. error: ", err)
+	}
+	defer s.Unsubscribe()
+	_ = Publish(&Event{Topic: "journal.test", Status: "third", Data: "third"})
+
+	var last int64
+	for _, status := range []string{"first", "second", "third"} {
+		e := <-s.Event()
+		if e.Status != status || e.Data != status {
+			t.Fatal("Expected ", status, ", got ", e.Status, " ", e.Data)
+		}
+		if e.Sequence <= last {
+			t.Fatal("Sequence should increase monotonically. ")
+		}
+		last = e.Sequence
+	}
+}
+
+func TestJournalReplayBatches(t *testing.T) {
+	db, err := database.NewDatabase("sqlite3", "test.db")
+	if err != nil {
+		t.Fatal("Failed to NewDatabase. error: ", err)
+	}
+	defer db.Close()
+	bus := NewBus()
+	if err := bus.EnableJournal(db, JournalOptions{TableName: "t_event_journal_batch"}); err != nil {
+		t.Fatal("Failed to EnableJournal. error: ", err)
+	}
+	defer bus.DisableJournal()
+
+	count := journalBatchSize*2 + 10
+	var first int64
+	for i := 0; i < count; i++ {
+		e := &Event{Topic: "journal.batch", Data: float64(i)}
+		_ = bus.Publish(e)
+		if i == 0 {
+			first = e.Sequence
+		}
+	}
+	s, err := bus.SubscribeFrom("journal.batch", first-1)
+	if err != nil {
+		t.Fatal("Failed to SubscribeFrom. error: ", err)
+	}
+	defer s.Unsubscribe()
+	_ = bus.Publish(&Event{Topic: "journal.batch", Data: float64(count)})
+	for i := 0; i <= count; i++ {
+		select {
+		case e := <-s.Event():
+			if e.Data != float64(i) {
+				t.Fatal("Expected ", i, ", got ", e.Data)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Replay should deliver every event, stopped at ", i)
+		}
+	}
+}
+
+func TestOutbox(t *testing.T) {
+	db, err := database.NewDatabase("sqlite3", "test.db")
+	if err != nil {
+		t.Fatal("Failed to NewDatabase. error: ", err)
+	}
+	defer db.Close()
+	o, err := NewOutbox(db, OutboxOptions{Interval: time.Hour})
+	if err != nil {
+		t.Fatal("Failed to NewOutbox. error: ", err)
+	}
+	o.Close()
+	if _, err := db.Exec("DELETE FROM t_event_outbox"); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := SubscribeWithOptions("outbox.test", Options{BufferSize: 10, Policy: PolicyDropNewest})
+	if err != nil {
+		t.Fatal("Failed to Subscribe. error: ", err)
+	}
+	defer s.Unsubscribe()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal("Failed to Begin. error: ", err)
+	}
+	if err := o.Write(tx, &Event{Topic: "outbox.test", Status: "rollback"}); err != nil {
+		t.Fatal("Failed to Write. error: ", err)
+	}
+	_ = tx.Rollback()
+
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatal("Failed to Begin. error: ", err)
+	}
+	committed := &Event{Topic: "outbox.test", Status: "commit", Data: "commit"}
+	if err := o.Write(tx, committed); err != nil {
+		t.Fatal("Failed to Write. error: ", err)
+	}
+	_ = tx.Commit()
+
+	if err := o.Flush(); err != nil {
+		t.Fatal("Failed to Flush. error: ", err)
+	}
+	if err := o.Flush(); err != nil {
+		t.Fatal("Failed to Flush. error: ", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	e := <-s.Event()
+	if e.Status != "commit" || e.Id != committed.Id || e.Data != "commit" {
+		t.Fatal("Unexpected event ", e)
+	}
+	select {
+	case e := <-s.Event():
+		t.Fatal("Event should be published exactly once, got ", e.Status)
+	default:
+	}
+
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatal("Failed to Begin. error: ", err)
+	}
+	if err := o.Write(tx, &Event{Topic: "outbox.test", Status: "claimed"}); err != nil {
+		t.Fatal("Failed to Write. error: ", err)
+	}
+	_ = tx.Commit()
+	if _, err := db.Exec("UPDATE t_event_outbox SET `owner` = 'crashed', `claimTime` = ?", time.Now().UnixNano()); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Flush(); err != nil {
+		t.Fatal("Failed to Flush. error: ", err)
+	}
+	if s.(PendingCounter).Pending() != 0 {
+		t.Fatal("Event claimed by another relay should not be published. ")
+	}
+	if _, err := db.Exec("UPDATE t_event_outbox SET `claimTime` = 1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Flush(); err != nil {
+		t.Fatal("Failed to Flush. error: ", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if e := <-s.Event(); e.Status != "claimed" {
+		t.Fatal("Stale claim should be taken over, got ", e.Status)
+	}
+}
+
+type testPayload struct {
+	Name string `json:"name"`
+}
+
+func TestCodec(t *testing.T) {
+	if err := RegisterType("codec.test", &testPayload{}); err != nil {
+		t.Fatal("Failed to RegisterType. error: ", err)
+	}
+	data, err := Marshal(&Event{Topic: "codec.test", Status: "created", Data: &testPayload{Name: "test"}})
+	if err != nil {
+		t.Fatal("Failed to Marshal. error: ", err)
+	}
+	e, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal("Failed to Unmarshal. error: ", err)
+	}
+	payload, ok := e.Data.(*testPayload)
+	if !ok || payload.Name != "test" || e.Topic != "codec.test" || e.Status != "created" {
+		t.Fatal("Unexpected event ", string(data))
+	}
+
+	e, err = Unmarshal([]byte(`{"topic":"codec.other","status":"created","data":{"name":"test"}}`))
+	if err != nil {
+		t.Fatal("Failed to Unmarshal. error: ", err)
+	}
+	if _, ok := e.Data.(map[string]interface{}); !ok {
+		t.Fatal("Untagged data should be decoded generically. ")
+	}
+	_, err = Unmarshal([]byte(`{"topic":"codec.other","status":"created","type":"unknown.Type","data":{}}`))
+	if err != ErrUnknownType {
+		t.Fatal("Unknown type should be rejected, not ", err)
+	}
+
+	type testContext struct {
+		User string `json:"user"`
+	}
+	if err := RegisterContextType(&testContext{}); err != nil {
+		t.Fatal("Failed to RegisterContextType. error: ", err)
+	}
+	data, err = Marshal(&Event{Topic: "codec.test", Status: "created", Context: &testContext{User: "admin"}})
+	if err != nil {
+		t.Fatal("Failed to Marshal. error: ", err)
+	}
+	e, err = Unmarshal(data)
+	if err != nil {
+		t.Fatal("Failed to Unmarshal. error: ", err)
+	}
+	context, ok := e.Context.(*testContext)
+	if !ok || context.User != "admin" {
+		t.Fatal("Context should be encoded with its type, got ", string(data))
+	}
+}
+
+func TestStats(t *testing.T) {
+	var published int64
+	for _, stats := range Stats() {
+		if stats.Topic == "stats.test" {
+			published = stats.Published
+		}
+	}
+	s, err := SubscribeWithOptions("stats.test", Options{BufferSize: 1, Policy: PolicyDropNewest})
+	if err != nil {
+		t.Fatal("Failed to Subscribe. error: ", err)
+	}
+	defer s.Unsubscribe()
+	for i := 0; i < 3; i++ {
+		_ = Publish(&Event{Topic: "stats.test"})
+	}
+
+	for _, stats := range Stats() {
+		if stats.Topic != "stats.test" {
+			continue
+		}
+		data, _ := json.Marshal(stats)
+		log.Print(string(data))
+		if stats.Published-published != 3 || stats.Subscribers != 1 || stats.Pending != 1 || stats.Dropped != 2 {
+			t.Fatal("Unexpected stats ", string(data))
+		}
+		return
+	}
+	t.Fatal("Stats of topic is not found. ")
+}
+
+func TestSubscribeContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s, err := SubscribeContext(ctx, "context.test")
+	if err != nil {
+		t.Fatal("Failed to SubscribeContext. error: ", err)
+	}
+	for i := 0; i < 10; i++ {
+		_ = Publish(&Event{Topic: "context.test", Data: i})
+	}
+	if e := <-s.Event(); e.Data != 0 {
+		t.Fatal("Unexpected event ", e.Data)
+	}
+	cancel()
+
+	timer := time.NewTimer(time.Second)
+	defer timer.Stop()
+	for {
+		select {
+		case _, ok := <-s.Event():
+			if ok {
+				continue
+			}
+		case <-timer.C:
+			t.Fatal("Subscription should end when context is cancelled. ")
+		}
+		break
+	}
+	s.Unsubscribe()
+	if err := Publish(&Event{Topic: "context.test"}); err != nil {
+		t.Fatal("Failed to Publish. error: ", err)
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	s, err := SubscribeWithOptions("schedule.test", Options{BufferSize: 10, Policy: PolicyDropNewest})
+	if err != nil {
+		t.Fatal("Failed to Subscribe. error: ", err)
+	}
+	defer s.Unsubscribe()
+
+	start := time.Now()
+	if _, err := PublishAfter(20*time.Millisecond, &Event{Topic: "schedule.test", Status: "after"}); err != nil {
+		t.Fatal("Failed to PublishAfter. error: ", err)
+	}
+	cancelled, err := PublishAt(start.Add(10*time.Millisecond), &Event{Topic: "schedule.test", Status: "cancelled"})
+	if err != nil {
+		t.Fatal("Failed to PublishAt. error: ", err)
+	}
+	if !cancelled.Cancel() || cancelled.Cancel() {
+		t.Fatal("Cancel should succeed only once. ")
+	}
+	e := <-s.Event()
+	if e.Status != "after" || time.Since(start) < 20*time.Millisecond {
+		t.Fatal("Unexpected event ", e.Status, " after ", time.Since(start))
+	}
+
+	db, err := database.NewDatabase("sqlite3", "test.db")
+	if err != nil {
+		t.Fatal("Failed to NewDatabase. error: ", err)
+	}
+	defer db.Close()
+	table, err := db.NewTable(&scheduleRecord{}, "t_event_schedule")
+	if err != nil {
+		t.Fatal("Failed to NewTable. error: ", err)
+	}
+	_, err = table.Create(&scheduleRecord{
+		Topic:       "schedule.test",
+		Status:      "persisted",
+		PublishTime: time.Now().Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		t.Fatal("Failed to Create. error: ", err)
+	}
+	if err := EnableSchedulePersistence(db, ""); err != nil {
+		t.Fatal("Failed to EnableSchedulePersistence. error: ", err)
+	}
+	defer DisableSchedulePersistence()
+	e = <-s.Event()
+	if e.Status != "persisted" {
+		t.Fatal("Unexpected event ", e.Status)
+	}
+
+	pending, err := PublishAfter(time.Hour, &Event{Topic: "schedule.test", Status: "pending"})
+	if err != nil {
+		t.Fatal("Failed to PublishAfter. error: ", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	values, _ := table.GetList("")
+	if len(values) != 1 {
+		t.Fatal("Only the pending schedule should be persisted, not ", len(values))
+	}
+	pending.Cancel()
+	values, _ = table.GetList("")
+	if len(values) != 0 {
+		t.Fatal("Cancelled schedule should be removed. ")
+	}
+}
+
+func TestBus(t *testing.T) {
+	bus := NewBus()
+	s, err := bus.SubscribeWithOptions("", Options{BufferSize: 10, Policy: PolicyDropNewest})
+	if err != nil {
+		t.Fatal("Failed to Subscribe. error: ", err)
+	}
+	defer s.Unsubscribe()
+	all, err := SubscribeWithOptions("", Options{BufferSize: 10, Policy: PolicyDropNewest})
+	if err != nil {
+		t.Fatal("Failed to Subscribe. error: ", err)
+	}
+	defer all.Unsubscribe()
+
+	_ = bus.Publish(&Event{Topic: "bus.test", Status: "bus"})
+	_ = Publish(&Event{Topic: "bus.test", Status: "default"})
+
+	if e := <-s.Event(); e.Status != "bus" {
+		t.Fatal("Unexpected event ", e.Status)
+	}
+	if e := <-all.Event(); e.Status != "default" {
+		t.Fatal("Unexpected event ", e.Status)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if s.(PendingCounter).Pending() != 0 || all.(PendingCounter).Pending() != 0 {
+		t.Fatal("Events should not leak between buses. ")
+	}
+	if Default() == bus {
+		t.Fatal("NewBus should not return the default bus. ")
+	}
+}
+
+func TestDeadLetter(t *testing.T) {
+	bus := NewBus()
+	letters, err := bus.Subscribe(TopicDeadLetter)
+	if err != nil {
+		t.Fatal("Failed to Subscribe. error: ", err)
+	}
+	defer letters.Unsubscribe()
+
+	var mutex sync.Mutex
+	attempts := 0
+	healthy := false
+	h, err := bus.SubscribeFunc("deadletter.test", "test", func(e *Event) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		attempts++
+		if healthy {
+			return nil
+		}
+		if attempts == 3 {
+			panic("handler panic")
+		}
+		return errors.New("Handler failed. ")
+	}, HandlerOptions{Retry: RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}})
+	if err != nil {
+		t.Fatal("Failed to SubscribeFunc. error: ", err)
+	}
+	defer h.Unsubscribe()
+	if _, err := bus.SubscribeFunc("deadletter.test", "test", func(e *Event) error { return nil }, HandlerOptions{}); err == nil {
+		t.Fatal("Duplicate name should be rejected. ")
+	}
+
+	_ = bus.Publish(&Event{Topic: "deadletter.test", Status: "test", Data: 1})
+	select {
+	case e := <-letters.Event():
+		letter := e.Data.(*DeadLetter)
+		if letter.Subscriber != "test" || letter.Attempts != 3 || letter.Event.Topic != "deadletter.test" {
+			t.Fatal("Unexpected dead letter ", letter)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Dead letter should be published. ")
+	}
+	list := bus.DeadLetters()
+	if len(list) != 1 {
+		t.Fatal("Dead letter should be stored. ")
+	}
+
+	mutex.Lock()
+	healthy = true
+	mutex.Unlock()
+	if err := bus.ReplayDeadLetter(list[0].Id); err != nil {
+		t.Fatal("Failed to ReplayDeadLetter. error: ", err)
+	}
+	if len(bus.DeadLetters()) != 0 {
+		t.Fatal("Replayed dead letter should be removed. ")
+	}
+	if err := bus.ReplayDeadLetter(list[0].Id); err == nil {
+		t.Fatal("Unknown dead letter should fail to replay. ")
+	}
+}
@@ -0,0 +1,261 @@
+package event
+
+import (
+	"errors"
+	"github.com/infinit-lab/gravity/database"
+	"github.com/infinit-lab/gravity/printer"
+	"time"
+)
+
+const journalBatchSize int = 500
+
+type JournalOptions struct {
+	TableName     string
+	MaxAge        time.Duration
+	MaxCount      int64
+	PruneInterval time.Duration
+}
+
+func EnableJournal(db database.Database, options JournalOptions) error {
+	return defaultBus.EnableJournal(db, options)
+}
+
+func DisableJournal() {
+	defaultBus.DisableJournal()
+}
+
+func SubscribeFrom(topic string, offset int64) (Subscriber, error) {
+	return defaultBus.SubscribeFrom(topic, offset)
+}
+
+func (b *Bus) EnableJournal(db database.Database, options JournalOptions) error {
+	if db == nil {
+		return errors.New("The database is nil. ")
+	}
+	if len(options.TableName) == 0 {
+		options.TableName = "t_event_journal"
+	}
+	if options.PruneInterval <= 0 {
+		options.PruneInterval = time.Minute
+	}
+	table, err := db.NewTable(&journalRecord{}, options.TableName)
+	if err != nil {
+		printer.Error(err)
+		return err
+	}
+
+	j := new(journal)
+	j.table = table
+	j.options = options
+	j.closeChan = make(chan int)
+
+	b.journalMutex.Lock()
+	defer b.journalMutex.Unlock()
+	if b.journal != nil {
+		return errors.New("The journal is already enabled. ")
+	}
+	b.journal = j
+	go j.pruneLoop()
+	return nil
+}
+
+func (b *Bus) DisableJournal() {
+	b.journalMutex.Lock()
+	defer b.journalMutex.Unlock()
+	if b.journal == nil {
+		return
+	}
+	close(b.journal.closeChan)
+	b.journal = nil
+}
+
+func (b *Bus) SubscribeFrom(topic string, offset int64) (Subscriber, error) {
+	if err := checkPattern(topic); err != nil {
+		return nil, err
+	}
+	s, err := b.newSubscriber(topic, Options{})
+	if err != nil {
+		return nil, err
+	}
+
+	b.journalMutex.Lock()
+	j := b.journal
+	b.journalMutex.Unlock()
+	if j == nil {
+		return nil, errors.New("The journal is not enabled. ")
+	}
+	s.pumpGroup.Add(1)
+	go b.replay(j, s, offset)
+	return s, nil
+}
+
+func (b *Bus) replay(j *journal, s *subscriber, offset int64) {
+	defer s.pumpGroup.Done()
+	for {
+		history, err := j.read(offset, journalBatchSize)
+		if err != nil {
+			printer.Error(err)
+			return
+		}
+		for _, event := range history {
+			offset = event.Sequence
+			if !MatchTopic(s.topic, event.Topic) || !s.accept(event) {
+				continue
+			}
+			select {
+			case s.c <- event:
+			case <-s.closeChan:
+				return
+			}
+		}
+		if len(history) < journalBatchSize {
+			break
+		}
+	}
+
+	b.journalMutex.Lock()
+	defer b.journalMutex.Unlock()
+	if b.journal == j {
+		for {
+			history, err := j.read(offset, journalBatchSize)
+			if err != nil {
+				printer.Error(err)
+				break
+			}
+			for _, event := range history {
+				offset = event.Sequence
+				if MatchTopic(s.topic, event.Topic) {
+					s.deliver(event)
+				}
+			}
+			if len(history) < journalBatchSize {
+				break
+			}
+		}
+	}
+
+	b.subscriberMutex.Lock()
+	defer b.subscriberMutex.Unlock()
+	if s.isRemoved {
+		return
+	}
+	b.subscriberMap[s.topic] = append(b.subscriberMap[s.topic], s)
+}
+
+type journalRecord struct {
+	database.PrimaryKey
+	EventId     string `json:"eventId" db:"eventId" db_type:"VARCHAR(64)" db_default:"''"`
+	Topic       string `json:"topic" db:"topic" db_type:"VARCHAR(256)" db_index:"index" db_default:"''"`
+	Status      string `json:"status" db:"status" db_type:"VARCHAR(64)" db_default:"''"`
+	Type        string `json:"type" db:"type" db_type:"VARCHAR(256)" db_default:"''"`
+	Data        string `json:"data" db:"data" db_type:"TEXT" db_default:"''"`
+	ContextType string `json:"contextType" db:"contextType" db_type:"VARCHAR(256)" db_default:"''"`
+	Context     string `json:"context" db:"context" db_type:"TEXT" db_default:"''"`
+	Time        string `json:"time" db:"time" db_type:"DATETIME" db_index:"index" db_omit:"create,update" db_default:"CURRENT_TIMESTAMP"`
+}
+
+type journal struct {
+	table     database.Table
+	options   JournalOptions
+	closeChan chan int
+}
+
+func (j *journal) append(event *Event) error {
+	record := new(journalRecord)
+	record.EventId = event.Id
+	record.Topic = event.Topic
+	record.Status = event.Status
+	tag, data, err := EncodeData(event.Data)
+	if err != nil {
+		return err
+	}
+	record.Type = tag
+	record.Data = string(data)
+	if tag, data, err = EncodeData(event.Context); err != nil {
+		return err
+	}
+	record.ContextType = tag
+	record.Context = string(data)
+	ret, err := j.table.Create(record)
+	if err != nil {
+		return err
+	}
+	sequence, err := ret.LastInsertId()
+	if err != nil {
+		return err
+	}
+	event.Sequence = sequence
+	return nil
+}
+
+func (j *journal) read(offset int64, limit int) ([]*Event, error) {
+	values, err := j.table.GetList("WHERE `id` > ? ORDER BY `id` LIMIT ?", offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	var events []*Event
+	for _, value := range values {
+		record := value.(*journalRecord)
+		event := new(Event)
+		event.Id = record.EventId
+		event.Topic = record.Topic
+		event.Status = record.Status
+		event.Sequence = int64(record.Id)
+		if event.Data, err = DecodeData(record.Topic, record.Type, []byte(record.Data)); err != nil {
+			printer.Error(err)
+		}
+		if event.Context, err = DecodeContext(record.ContextType, []byte(record.Context)); err != nil {
+			printer.Error(err)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func (j *journal) prune() error {
+	if j.options.MaxAge > 0 {
+		before := time.Now().UTC().Add(-j.options.MaxAge).Format("2006-01-02 15:04:05")
+		if _, err := j.table.Delete("WHERE `time` < ?", before); err != nil {
+			return err
+		}
+	}
+	if j.options.MaxCount > 0 {
+		rows, err := j.table.Database().Query("SELECT MAX(`id`) FROM " + j.table.TableName())
+		if err != nil {
+			return err
+		}
+		var last int64
+		for rows.Next() {
+			var value *int64
+			if err := rows.Scan(&value); err != nil {
+				_ = rows.Close()
+				return err
+			}
+			if value != nil {
+				last = *value
+			}
+		}
+		_ = rows.Close()
+		if last > j.options.MaxCount {
+			if _, err := j.table.Delete("WHERE `id` <= ?", last-j.options.MaxCount); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (j *journal) pruneLoop() {
+	ticker := time.NewTicker(j.options.PruneInterval)
+	defer ticker.Stop()
+	for {
+		if err := j.prune(); err != nil {
+			printer.Error(err)
+		}
+		select {
+		case <-ticker.C:
+		case <-j.closeChan:
+			return
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package event
+
+import (
+	"errors"
+	"github.com/infinit-lab/gravity/database"
+	"github.com/infinit-lab/gravity/printer"
+	uuid "github.com/satori/go.uuid"
+	"strings"
+	"sync"
+	"time"
+)
+
+type OutboxOptions struct {
+	TableName    string
+	Interval     time.Duration
+	ClaimTimeout time.Duration
+}
+
+type Outbox interface {
+	Write(tx database.Tx, event *Event) error
+	Flush() error
+	Close()
+}
+
+func NewOutbox(db database.Database, options OutboxOptions) (Outbox, error) {
+	return defaultBus.NewOutbox(db, options)
+}
+
+func (b *Bus) NewOutbox(db database.Database, options OutboxOptions) (Outbox, error) {
+	if db == nil {
+		return nil, errors.New("The database is nil. ")
+	}
+	if len(options.TableName) == 0 {
+		options.TableName = "t_event_outbox"
+	}
+	if options.Interval <= 0 {
+		options.Interval = time.Second
+	}
+	if options.ClaimTimeout <= 0 {
+		options.ClaimTimeout = time.Minute
+	}
+	table, err := db.NewTable(&outboxRecord{}, options.TableName)
+	if err != nil {
+		printer.Error(err)
+		return nil, err
+	}
+	o := new(outbox)
+	o.bus = b
+	o.table = table
+	o.options = options
+	o.owner = strings.ReplaceAll(uuid.NewV4().String(), "-", "")
+	o.flushChan = make(chan int, 1)
+	o.closeChan = make(chan int)
+	go o.relayLoop()
+	return o, nil
+}
+
+type outboxRecord struct {
+	database.PrimaryKey
+	EventId     string `json:"eventId" db:"eventId" db_type:"VARCHAR(64)" db_default:"''"`
+	Topic       string `json:"topic" db:"topic" db_type:"VARCHAR(256)" db_default:"''"`
+	Status      string `json:"status" db:"status" db_type:"VARCHAR(64)" db_default:"''"`
+	Type        string `json:"type" db:"type" db_type:"VARCHAR(256)" db_default:"''"`
+	Data        string `json:"data" db:"data" db_type:"TEXT" db_default:"''"`
+	ContextType string `json:"contextType" db:"contextType" db_type:"VARCHAR(256)" db_default:"''"`
+	Context     string `json:"context" db:"context" db_type:"TEXT" db_default:"''"`
+	Owner       string `json:"owner" db:"owner" db_type:"VARCHAR(64)" db_default:"''"`
+	ClaimTime   int64  `json:"claimTime" db:"claimTime" db_type:"BIGINT" db_default:"0"`
+	Time        string `json:"time" db:"time" db_type:"DATETIME" db_omit:"create,update" db_default:"CURRENT_TIMESTAMP"`
+}
+
+type outbox struct {
+	bus        *Bus
+	table      database.Table
+	options    OutboxOptions
+	owner      string
+	relayMutex sync.Mutex
+	flushChan  chan int
+	closeChan  chan int
+	closeOnce  sync.Once
+}
+
+func (o *outbox) Write(tx database.Tx, event *Event) error {
+	if tx == nil {
+		return errors.New("The transaction is nil. ")
+	}
+	if event == nil {
+		return errors.New("The event is nil. ")
+	}
+	if err := checkTopic(event.Topic); err != nil {
+		return err
+	}
+	if len(event.Id) == 0 {
+		event.Id = strings.ReplaceAll(uuid.NewV4().String(), "-", "")
+	}
+	record := new(outboxRecord)
+	record.EventId = event.Id
+	record.Topic = event.Topic
+	record.Status = event.Status
+	tag, data, err := EncodeData(event.Data)
+	if err != nil {
+		printer.Error(err)
+		return err
+	}
+	record.Type = tag
+	record.Data = string(data)
+	if tag, data, err = EncodeData(event.Context); err != nil {
+		printer.Error(err)
+		return err
+	}
+	record.ContextType = tag
+	record.Context = string(data)
+	query, args, err := o.table.CreateSql(record)
+	if err != nil {
+		printer.Error(err)
+		return err
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		return err
+	}
+	select {
+	case o.flushChan <- 0:
+	default:
+	}
+	return nil
+}
+
+func (o *outbox) Flush() error {
+	o.relayMutex.Lock()
+	defer o.relayMutex.Unlock()
+
+	now := time.Now().UnixNano()
+	_, err := o.table.Database().Exec("UPDATE "+o.table.TableName()+" SET `owner` = ?, `claimTime` = ? WHERE `owner` = ? OR `owner` = '' OR `claimTime` < ?",
+		o.owner, now, o.owner, now-int64(o.options.ClaimTimeout))
+	if err != nil {
+		printer.Error(err)
+		return err
+	}
+	values, err := o.table.GetList("WHERE `owner` = ? AND `claimTime` = ? ORDER BY `id`", o.owner, now)
+	if err != nil {
+		printer.Error(err)
+		return err
+	}
+	for _, value := range values {
+		record := value.(*outboxRecord)
+		event := new(Event)
+		event.Id = record.EventId
+		event.Topic = record.Topic
+		event.Status = record.Status
+		if event.Data, err = DecodeData(record.Topic, record.Type, []byte(record.Data)); err != nil {
+			printer.Error(err)
+		}
+		if event.Context, err = DecodeContext(record.ContextType, []byte(record.Context)); err != nil {
+			printer.Error(err)
+		}
+		if err := o.bus.Publish(event); err != nil {
+			printer.Error(err)
+		}
+		if _, err := o.table.Delete("WHERE `id` = ? AND `owner` = ?", record.Id, o.owner); err != nil {
+			printer.Error(err)
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *outbox) Close() {
+	o.closeOnce.Do(func() {
+		close(o.closeChan)
+	})
+}
+
+func (o *outbox) relayLoop() {
+	ticker := time.NewTicker(o.options.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-o.flushChan:
+		case <-o.closeChan:
+			return
+		}
+		_ = o.Flush()
+	}
+}
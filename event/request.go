@@ -0,0 +1,156 @@
+package event
+
+import (
+	"errors"
+	"fmt"
+	"github.com/infinit-lab/gravity/printer"
+	uuid "github.com/satori/go.uuid"
+	"strings"
+	"time"
+)
+
+const (
+	StatusRequest string = "request"
+	StatusReply   string = "reply"
+)
+
+var (
+	ErrNoResponder = errors.New("No responder. ")
+	ErrTimeout     = errors.New("Request timeout. ")
+)
+
+type ResponderFunc func(request *Event) (interface{}, error)
+
+type Responder interface {
+	Unregister()
+}
+
+func Respond(topic string, handler ResponderFunc) (Responder, error) {
+	return defaultBus.Respond(topic, handler)
+}
+
+func Request(topic string, data interface{}, timeout time.Duration) (*Event, error) {
+	return defaultBus.Request(topic, data, timeout)
+}
+
+func (b *Bus) Respond(topic string, handler ResponderFunc) (Responder, error) {
+	if err := checkPattern(topic); err != nil {
+		return nil, err
+	}
+	if handler == nil {
+		return nil, errors.New("The handler is nil. ")
+	}
+	r := new(responder)
+	r.bus = b
+	r.topic = topic
+	r.handler = handler
+
+	b.responderMutex.Lock()
+	defer b.responderMutex.Unlock()
+	b.responderList = append(b.responderList, r)
+	return r, nil
+}
+
+func (b *Bus) Request(topic string, data interface{}, timeout time.Duration) (*Event, error) {
+	if err := checkTopic(topic); err != nil {
+		return nil, err
+	}
+	r, ok := b.nextResponder(topic)
+	if !ok {
+		return nil, ErrNoResponder
+	}
+
+	request := new(Event)
+	request.Topic = topic
+	request.Status = StatusRequest
+	request.Data = data
+	request.Id = strings.ReplaceAll(uuid.NewV4().String(), "-", "")
+
+	c := make(chan *reply, 1)
+	b.pendingMutex.Lock()
+	b.pendingMap[request.Id] = c
+	b.pendingMutex.Unlock()
+	defer func() {
+		b.pendingMutex.Lock()
+		delete(b.pendingMap, request.Id)
+		b.pendingMutex.Unlock()
+	}()
+
+	go r.serve(request)
+
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case rep := <-c:
+		return rep.event, rep.err
+	case <-timer.C:
+		return nil, ErrTimeout
+	}
+}
+
+type responder struct {
+	bus     *Bus
+	topic   string
+	handler ResponderFunc
+}
+
+type reply struct {
+	event *Event
+	err   error
+}
+
+func (b *Bus) nextResponder(topic string) (*responder, bool) {
+	b.responderMutex.Lock()
+	defer b.responderMutex.Unlock()
+	for i := 0; i < len(b.responderList); i++ {
+		b.responderIndex = (b.responderIndex + 1) % len(b.responderList)
+		r := b.responderList[b.responderIndex]
+		if MatchTopic(r.topic, topic) {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+func (r *responder) Unregister() {
+	r.bus.responderMutex.Lock()
+	defer r.bus.responderMutex.Unlock()
+	list := r.bus.responderList
+	for i, temp := range list {
+		if temp == r {
+			r.bus.responderList = append(list[:i:i], list[i+1:]...)
+			break
+		}
+	}
+}
+
+func (r *responder) serve(request *Event) {
+	var data interface{}
+	var err error
+	defer func() {
+		if e := recover(); e != nil {
+			printer.Error(e)
+			err = fmt.Errorf("Responder panic: %v. ", e)
+		}
+		rep := new(reply)
+		rep.event = new(Event)
+		rep.event.Topic = request.Topic
+		rep.event.Status = StatusReply
+		rep.event.Data = data
+		rep.event.Id = request.Id
+		rep.err = err
+
+		r.bus.pendingMutex.Lock()
+		c, ok := r.bus.pendingMap[request.Id]
+		r.bus.pendingMutex.Unlock()
+		if !ok {
+			printer.Warning("Reply of request ", request.Id, " is too late. ")
+			return
+		}
+		c <- rep
+	}()
+	data, err = r.handler(request)
+}
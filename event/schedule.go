@@ -0,0 +1,218 @@
+package event
+
+import (
+	"errors"
+	"github.com/infinit-lab/gravity/database"
+	"github.com/infinit-lab/gravity/printer"
+	"sync"
+	"time"
+)
+
+type Schedule interface {
+	Time() time.Time
+	Cancel() bool
+}
+
+func PublishAt(at time.Time, event *Event) (Schedule, error) {
+	return defaultBus.PublishAt(at, event)
+}
+
+func PublishAfter(d time.Duration, event *Event) (Schedule, error) {
+	return defaultBus.PublishAfter(d, event)
+}
+
+func EnableSchedulePersistence(db database.Database, tableName string) error {
+	return defaultBus.EnableSchedulePersistence(db, tableName)
+}
+
+func DisableSchedulePersistence() {
+	defaultBus.DisableSchedulePersistence()
+}
+
+func (b *Bus) PublishAt(at time.Time, event *Event) (Schedule, error) {
+	if event == nil {
+		return nil, errors.New("The event is nil. ")
+	}
+	if err := checkTopic(event.Topic); err != nil {
+		return nil, err
+	}
+	s := new(schedule)
+	s.bus = b
+	s.at = at
+	s.event = event
+
+	b.scheduleMutex.Lock()
+	table := b.scheduleTable
+	b.scheduleMutex.Unlock()
+	if table != nil {
+		if err := s.save(table); err != nil {
+			printer.Error(err)
+			return nil, err
+		}
+	}
+	s.start()
+	return s, nil
+}
+
+func (b *Bus) PublishAfter(d time.Duration, event *Event) (Schedule, error) {
+	return b.PublishAt(time.Now().Add(d), event)
+}
+
+func (b *Bus) EnableSchedulePersistence(db database.Database, tableName string) error {
+	if db == nil {
+		return errors.New("The database is nil. ")
+	}
+	if len(tableName) == 0 {
+		tableName = "t_event_schedule"
+	}
+	table, err := db.NewTable(&scheduleRecord{}, tableName)
+	if err != nil {
+		printer.Error(err)
+		return err
+	}
+
+	b.scheduleMutex.Lock()
+	if b.scheduleTable != nil {
+		b.scheduleMutex.Unlock()
+		return errors.New("The schedule persistence is already enabled. ")
+	}
+	b.scheduleTable = table
+	b.scheduleMutex.Unlock()
+
+	values, err := table.GetList("ORDER BY `id`")
+	if err != nil {
+		printer.Error(err)
+		return err
+	}
+	for _, value := range values {
+		record := value.(*scheduleRecord)
+		s := new(schedule)
+		s.bus = b
+		s.id = record.Id
+		s.table = table
+		s.at, err = time.Parse(time.RFC3339Nano, record.PublishTime)
+		if err != nil {
+			printer.Error(err)
+			continue
+		}
+		s.event = new(Event)
+		s.event.Id = record.EventId
+		s.event.Topic = record.Topic
+		s.event.Status = record.Status
+		if s.event.Data, err = DecodeData(record.Topic, record.Type, []byte(record.Data)); err != nil {
+			printer.Error(err)
+		}
+		if s.event.Context, err = DecodeContext(record.ContextType, []byte(record.Context)); err != nil {
+			printer.Error(err)
+		}
+		s.start()
+	}
+	return nil
+}
+
+func (b *Bus) DisableSchedulePersistence() {
+	b.scheduleMutex.Lock()
+	defer b.scheduleMutex.Unlock()
+	b.scheduleTable = nil
+}
+
+type scheduleRecord struct {
+	database.PrimaryKey
+	EventId     string `json:"eventId" db:"eventId" db_type:"VARCHAR(64)" db_default:"''"`
+	Topic       string `json:"topic" db:"topic" db_type:"VARCHAR(256)" db_default:"''"`
+	Status      string `json:"status" db:"status" db_type:"VARCHAR(64)" db_default:"''"`
+	Type        string `json:"type" db:"type" db_type:"VARCHAR(256)" db_default:"''"`
+	Data        string `json:"data" db:"data" db_type:"TEXT" db_default:"''"`
+	ContextType string `json:"contextType" db:"contextType" db_type:"VARCHAR(256)" db_default:"''"`
+	Context     string `json:"context" db:"context" db_type:"TEXT" db_default:"''"`
+	PublishTime string `json:"publishTime" db:"publishTime" db_type:"VARCHAR(64)" db_default:"''"`
+}
+
+type schedule struct {
+	bus    *Bus
+	id     int
+	table  database.Table
+	at     time.Time
+	event  *Event
+	timer  *time.Timer
+	isDone bool
+	mutex  sync.Mutex
+}
+
+func (s *schedule) save(table database.Table) error {
+	record := new(scheduleRecord)
+	record.EventId = s.event.Id
+	record.Topic = s.event.Topic
+	record.Status = s.event.Status
+	record.PublishTime = s.at.Format(time.RFC3339Nano)
+	tag, data, err := EncodeData(s.event.Data)
+	if err != nil {
+		return err
+	}
+	record.Type = tag
+	record.Data = string(data)
+	if tag, data, err = EncodeData(s.event.Context); err != nil {
+		return err
+	}
+	record.ContextType = tag
+	record.Context = string(data)
+	ret, err := table.Create(record)
+	if err != nil {
+		return err
+	}
+	id, err := ret.LastInsertId()
+	if err != nil {
+		return err
+	}
+	s.id = int(id)
+	s.table = table
+	return nil
+}
+
+func (s *schedule) remove() {
+	if s.table == nil {
+		return
+	}
+	if _, err := s.table.Delete("WHERE `id` = ?", s.id); err != nil {
+		printer.Error(err)
+	}
+}
+
+func (s *schedule) start() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.timer = time.AfterFunc(time.Until(s.at), s.fire)
+}
+
+func (s *schedule) fire() {
+	s.mutex.Lock()
+	if s.isDone {
+		s.mutex.Unlock()
+		return
+	}
+	s.isDone = true
+	s.mutex.Unlock()
+
+	if err := s.bus.Publish(s.event); err != nil {
+		printer.Error(err)
+	}
+	s.remove()
+}
+
+func (s *schedule) Time() time.Time {
+	return s.at
+}
+
+func (s *schedule) Cancel() bool {
+	s.mutex.Lock()
+	if s.isDone {
+		s.mutex.Unlock()
+		return false
+	}
+	s.isDone = true
+	s.timer.Stop()
+	s.mutex.Unlock()
+
+	s.remove()
+	return true
+}
@@ -0,0 +1,78 @@
+package event
+
+import (
+	"sort"
+	"time"
+)
+
+type TopicStats struct {
+	Topic       string `json:"topic"`
+	Published   int64  `json:"published"`
+	LastPublish string `json:"lastPublish,omitempty"`
+	Subscribers int    `json:"subscribers"`
+	Pending     int    `json:"pending"`
+	Dropped     int64  `json:"dropped"`
+}
+
+func Stats() []*TopicStats {
+	return defaultBus.Stats()
+}
+
+func (b *Bus) Stats() []*TopicStats {
+	b.subscriberMutex.Lock()
+	defer b.subscriberMutex.Unlock()
+
+	statsMap := make(map[string]*TopicStats)
+	get := func(topic string) *TopicStats {
+		stats, ok := statsMap[topic]
+		if !ok {
+			stats = &TopicStats{Topic: topic}
+			statsMap[topic] = stats
+		}
+		return stats
+	}
+	for topic, p := range b.publishMap {
+		stats := get(topic)
+		stats.Published = p.count
+		stats.LastPublish = p.last.Format("2006-01-02 15:04:05")
+	}
+	for topic, list := range b.subscriberMap {
+		if len(list) == 0 {
+			continue
+		}
+		stats := get(topic)
+		for _, s := range list {
+			stats.Subscribers++
+			if p, ok := s.(PendingCounter); ok {
+				stats.Pending += p.Pending()
+			}
+			if d, ok := s.(DropCounter); ok {
+				stats.Dropped += d.Dropped()
+			}
+		}
+	}
+
+	var statsList []*TopicStats
+	for _, stats := range statsMap {
+		statsList = append(statsList, stats)
+	}
+	sort.Slice(statsList, func(i, j int) bool {
+		return statsList[i].Topic < statsList[j].Topic
+	})
+	return statsList
+}
+
+type publishStats struct {
+	count int64
+	last  time.Time
+}
+
+func (b *Bus) countPublish(topic string) {
+	p, ok := b.publishMap[topic]
+	if !ok {
+		p = new(publishStats)
+		b.publishMap[topic] = p
+	}
+	p.count++
+	p.last = time.Now()
+}
@@ -0,0 +1,135 @@
+package event
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+type SyncHandlerFunc func(e *Event) error
+
+type SyncHandler interface {
+	Unregister()
+}
+
+type SyncError struct {
+	Errors []error
+}
+
+func (e *SyncError) Error() string {
+	var messages []string
+	for _, err := range e.Errors {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+type VetoError struct {
+	Reason error
+}
+
+func (e *VetoError) Error() string {
+	return "Vetoed: " + e.Reason.Error()
+}
+
+func Veto(reason error) error {
+	if reason == nil {
+		reason = errors.New("No reason. ")
+	}
+	return &VetoError{Reason: reason}
+}
+
+func IsVeto(err error) bool {
+	var veto *VetoError
+	return errors.As(err, &veto)
+}
+
+func RegisterSyncHandler(topic string, priority int, handler SyncHandlerFunc) (SyncHandler, error) {
+	return defaultBus.RegisterSyncHandler(topic, priority, handler)
+}
+
+func PublishSync(event *Event) error {
+	return defaultBus.PublishSync(event)
+}
+
+func (b *Bus) RegisterSyncHandler(topic string, priority int, handler SyncHandlerFunc) (SyncHandler, error) {
+	if err := checkPattern(topic); err != nil {
+		return nil, err
+	}
+	if handler == nil {
+		return nil, errors.New("The handler is nil. ")
+	}
+	h := new(syncHandler)
+	h.bus = b
+	h.topic = topic
+	h.priority = priority
+	h.handler = handler
+
+	b.syncHandlerMutex.Lock()
+	defer b.syncHandlerMutex.Unlock()
+	b.syncHandlerIndex++
+	h.index = b.syncHandlerIndex
+	list := append(b.syncHandlerList, h)
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].priority != list[j].priority {
+			return list[i].priority > list[j].priority
+		}
+		return list[i].index < list[j].index
+	})
+	b.syncHandlerList = list
+	return h, nil
+}
+
+func (b *Bus) PublishSync(event *Event) error {
+	if event == nil {
+		return errors.New("The event is nil. ")
+	}
+	if err := checkTopic(event.Topic); err != nil {
+		return err
+	}
+
+	b.syncHandlerMutex.Lock()
+	var list []*syncHandler
+	for _, h := range b.syncHandlerList {
+		if MatchTopic(h.topic, event.Topic) {
+			list = append(list, h)
+		}
+	}
+	b.syncHandlerMutex.Unlock()
+
+	var errs []error
+	for _, h := range list {
+		err := h.handler(event)
+		if err == nil {
+			continue
+		}
+		if IsVeto(err) {
+			return err
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) != 0 {
+		return &SyncError{Errors: errs}
+	}
+	return nil
+}
+
+type syncHandler struct {
+	bus      *Bus
+	topic    string
+	priority int
+	index    int
+	handler  SyncHandlerFunc
+}
+
+func (h *syncHandler) Unregister() {
+	h.bus.syncHandlerMutex.Lock()
+	defer h.bus.syncHandlerMutex.Unlock()
+	list := h.bus.syncHandlerList
+	for i, handler := range list {
+		if handler == h {
+			h.bus.syncHandlerList = append(list[:i:i], list[i+1:]...)
+			break
+		}
+	}
+}
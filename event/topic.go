@@ -0,0 +1,77 @@
+package event
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	WildcardSingle string = "*"
+	WildcardMulti  string = "#"
+	topicSeparator string = "."
+)
+
+func checkPattern(pattern string) error {
+	if len(pattern) == 0 {
+		return nil
+	}
+	for _, level := range strings.Split(pattern, topicSeparator) {
+		if level == WildcardSingle || level == WildcardMulti {
+			continue
+		}
+		if strings.Contains(level, WildcardSingle) || strings.Contains(level, WildcardMulti) {
+			return errors.New("Wildcard must occupy a whole level of the topic. ")
+		}
+	}
+	return nil
+}
+
+func checkTopic(topic string) error {
+	if len(topic) == 0 {
+		return errors.New("Topic is empty. ")
+	}
+	if strings.Contains(topic, WildcardSingle) || strings.Contains(topic, WildcardMulti) {
+		return errors.New("Topic of a published event must not contain wildcard. ")
+	}
+	return nil
+}
+
+func MatchTopic(pattern string, topic string) bool {
+	if len(pattern) == 0 || pattern == topic {
+		return true
+	}
+	if !strings.Contains(pattern, WildcardSingle) && !strings.Contains(pattern, WildcardMulti) {
+		return false
+	}
+	return matchLevels(strings.Split(pattern, topicSeparator), strings.Split(topic, topicSeparator))
+}
+
+func matchLevels(pattern []string, topic []string) bool {
+	if len(pattern) == 0 {
+		return len(topic) == 0
+	}
+	switch pattern[0] {
+	case WildcardMulti:
+		for i := 0; i <= len(topic); i++ {
+			if matchLevels(pattern[1:], topic[i:]) {
+				return true
+			}
+		}
+		return false
+	case WildcardSingle:
+		return len(topic) != 0 && matchLevels(pattern[1:], topic[1:])
+	default:
+		return len(topic) != 0 && pattern[0] == topic[0] && matchLevels(pattern[1:], topic[1:])
+	}
+}
+
+func MatchStatus(status ...string) func(e *Event) bool {
+	return func(e *Event) bool {
+		for _, s := range status {
+			if e.Status == s {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -10,6 +10,7 @@ import (
 )
 
 type model struct {
+	db database.Database
 	table database.Table
 	topic string
 	cacheDatabase database.Database
@@ -17,10 +18,12 @@ type model struct {
 	mutex sync.RWMutex
 	getLayer func(resource interface{})
 	notifyLayer func(resource interface{})
+	outbox event.Outbox
 }
 
 func (m *model)init(db database.Database, resource interface{}, topic string, isCache bool, tableName string) error {
 	var err error
+	m.db = db
 	m.table, err = db.NewTable(resource, tableName)
 	if err != nil {
 		printer.Error(err)
@@ -155,6 +158,24 @@ func (m *model)Create(resource Code, context interface{}) (string, error) {
 		}
 		resource.SetCode(strconv.FormatInt(code, 16))
 	}
+	if err := m.before(StatusBeforeCreate, resource, context); err != nil {
+		printer.Error(err)
+		return "", err
+	}
+	if m.outbox != nil {
+		query, values, err := m.table.CreateSql(resource)
+		if err != nil {
+			printer.Error(err)
+			return "", err
+		}
+		if _, err := m.execWithOutbox(query, values, StatusCreated, context, func(tx database.Tx) (interface{}, error) {
+			return m.getTx(tx, "WHERE `code` = ?", resource.GetCode())
+		}); err != nil {
+			printer.Error(err)
+			return "", err
+		}
+		return resource.GetCode(), nil
+	}
 	_, err := m.table.Create(resource)
 	if err != nil {
 		printer.Error(err)
@@ -180,6 +201,28 @@ func (m *model)Create(resource Code, context interface{}) (string, error) {
 }
 
 func (m *model)Update(resource interface{}, context interface{}, whereSql string, args ...interface{}) error {
+	if err := m.before(StatusBeforeUpdate, resource, context); err != nil {
+		printer.Error(err)
+		return err
+	}
+	if m.outbox != nil {
+		query, values, err := m.table.UpdateSql(resource, whereSql, args...)
+		if err != nil {
+			printer.Error(err)
+			return err
+		}
+		rows, err := m.execWithOutbox(query, values, StatusUpdated, context, func(tx database.Tx) (interface{}, error) {
+			return m.getTx(tx, whereSql, args...)
+		})
+		if err != nil {
+			printer.Error(err)
+			return err
+		}
+		if rows != 0 {
+			_, _ = m.SyncSingle(whereSql, args...)
+		}
+		return nil
+	}
 	ret, err := m.table.Update(resource, whereSql, args...)
 	if err != nil {
 		printer.Error(err)
@@ -218,6 +261,23 @@ func (m *model)Delete(context interface{}, whereSql string, args ...interface{})
 		printer.Error(err)
 		return err
 	}
+	if err := m.before(StatusBeforeDelete, value, context); err != nil {
+		printer.Error(err)
+		return err
+	}
+	if m.outbox != nil {
+		query, values := m.table.DeleteSql(whereSql, args...)
+		if _, err := m.execWithOutbox(query, values, StatusDeleted, context, func(tx database.Tx) (interface{}, error) {
+			return value, nil
+		}); err != nil {
+			printer.Error(err)
+			return err
+		}
+		if m.cacheTable != nil {
+			_, _ = m.cacheTable.Delete(whereSql, args...)
+		}
+		return nil
+	}
 	_, err = m.table.Delete(whereSql, args...)
 	if err != nil {
 		printer.Error(err)
@@ -244,6 +304,85 @@ func (m *model)DeleteByCode(code string, context interface{}) error {
 	return m.Delete(context, "WHERE `code` = ?", code)
 }
 
+func (m *model)getTx(tx database.Tx, whereSql string, args ...interface{}) (interface{}, error) {
+	value, err := m.table.GetTx(tx, whereSql, args...)
+	if err != nil {
+		printer.Error(err)
+		return nil, err
+	}
+	if m.getLayer != nil {
+		m.getLayer(value)
+	}
+	return value, nil
+}
+
+func (m *model)newEvent(status string, resource interface{}, context interface{}) *event.Event {
+	e := new(event.Event)
+	e.Topic = m.topic
+	e.Status = status
+	e.Data = resource
+	e.Context = context
+	return e
+}
+
+func (m *model)execWithOutbox(query string, values []interface{}, status string, context interface{}, read func(tx database.Tx) (interface{}, error)) (int64, error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		printer.Error(err)
+		return 0, err
+	}
+	ret, err := tx.Exec(query, values...)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+	rows, err := ret.RowsAffected()
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+	if rows == 0 {
+		_ = tx.Rollback()
+		return 0, nil
+	}
+	if len(m.topic) != 0 {
+		value, err := read(tx)
+		if err != nil {
+			_ = tx.Rollback()
+			return 0, err
+		}
+		e := m.newEvent(status, value, context)
+		if m.notifyLayer != nil {
+			m.notifyLayer(e)
+		}
+		if err := m.outbox.Write(tx, e); err != nil {
+			_ = tx.Rollback()
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+func (m *model)before(status string, resource interface{}, context interface{}) error {
+	if len(m.topic) == 0 {
+		return nil
+	}
+	e := new(event.Event)
+	e.Topic = m.topic
+	e.Status = status
+	e.Data = resource
+	e.Context = context
+	err := event.PublishSync(e)
+	if err != nil && !event.IsVeto(err) {
+		printer.Error(err)
+		return nil
+	}
+	return err
+}
+
 func (m *model)Sync() error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
@@ -284,3 +423,7 @@ func (m *model)SetBeforeNotifyLayer(layer func(resource interface{})) {
 	m.notifyLayer = layer
 }
 
+func (m *model)SetOutbox(outbox event.Outbox) {
+	m.outbox = outbox
+}
+
@@ -42,6 +42,10 @@ const (
 	StatusCreated string = "created"
 	StatusUpdated string = "updated"
 	StatusDeleted string = "deleted"
+
+	StatusBeforeCreate string = "beforeCreate"
+	StatusBeforeUpdate string = "beforeUpdate"
+	StatusBeforeDelete string = "beforeDelete"
 )
 
 type Model interface {
@@ -59,6 +63,7 @@ type Model interface {
 	SyncSingle(whereSql string, args ...interface{}) (interface{}, error)
 	SetBeforeGetLayer(layer func(resource interface{}))
 	SetBeforeNotifyLayer(layer func(resource interface{}))
+	SetOutbox(outbox event.Outbox)
 }
 
 func New(db database.Database, resource Code, topic string, isCache bool, tableName string) (Model, error) {
@@ -2,11 +2,13 @@ package model
 
 import (
 	"encoding/json"
+	"errors"
 	"github.com/infinit-lab/gravity/database"
 	"github.com/infinit-lab/gravity/event"
 	"github.com/infinit-lab/gravity/printer"
 	"sync"
 	"testing"
+	"time"
 )
 
 var code string
@@ -98,3 +100,118 @@ func TestNew(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestBeforeHook(t *testing.T) {
+	db, err := database.NewDatabase("sqlite3", "test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := New(db, &Resource{}, "hookTopic", true, "t_hook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := event.RegisterSyncHandler("hookTopic", 0, func(e *event.Event) error {
+		if e.Status == StatusBeforeCreate && e.Data.(*Resource).Name == "forbidden" {
+			return event.Veto(errors.New("Forbidden name. "))
+		}
+		if e.Status == StatusBeforeCreate && e.Data.(*Resource).Name == "faulty" {
+			return errors.New("Handler failed. ")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Unregister()
+
+	var r Resource
+	r.Name = "forbidden"
+	if _, err := m.Create(&r, nil); !event.IsVeto(err) {
+		t.Fatal("Create should be vetoed, not ", err)
+	}
+	if _, err := m.GetByCode(r.Code); err == nil {
+		t.Fatal("Vetoed resource should not be created. ")
+	}
+
+	r = Resource{}
+	r.Name = "allowed"
+	code, err := m.Create(&r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.DeleteByCode(code, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	r = Resource{}
+	r.Name = "faulty"
+	code, err = m.Create(&r, nil)
+	if err != nil {
+		t.Fatal("Non-veto error should not abort Create. error: ", err)
+	}
+	if err := m.DeleteByCode(code, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOutbox(t *testing.T) {
+	db, err := database.NewDatabase("sqlite3", "test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := New(db, &Resource{}, "outboxTopic", true, "t_outbox_model")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := event.RegisterType("outboxTopic", &Resource{}); err != nil {
+		t.Fatal(err)
+	}
+	o, err := event.NewOutbox(db, event.OutboxOptions{TableName: "t_outbox_model_event", Interval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.Close()
+	if _, err := db.Exec("DELETE FROM t_outbox_model_event"); err != nil {
+		t.Fatal(err)
+	}
+	m.SetOutbox(o)
+	s, err := event.SubscribeWithOptions("outboxTopic", event.Options{BufferSize: 10, Policy: event.PolicyDropNewest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Unsubscribe()
+
+	var r Resource
+	r.Name = "outbox"
+	r.Creator = "creator"
+	code, err := m.Create(&r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var u Resource
+	u.Code = code
+	u.Name = "updated"
+	if err := m.UpdateByCode(&u, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.DeleteByCode(code, nil); err != nil {
+		t.Fatal(err)
+	}
+	if s.(event.PendingCounter).Pending() != 0 {
+		t.Fatal("Events should wait for the outbox relay. ")
+	}
+	if err := o.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range []string{StatusCreated, StatusUpdated, StatusDeleted} {
+		select {
+		case e := <-s.Event():
+			value := e.Data.(*Resource)
+			if e.Status != status || value.Code != code || value.Id == 0 || len(value.CreateTime) == 0 || value.Creator != "creator" {
+				t.Fatal("Event should carry the stored row ", e.Status, value)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Timeout waiting for ", status)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package net_event
+
+import (
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/infinit-lab/gravity/config"
+	"github.com/infinit-lab/gravity/event"
+	"github.com/infinit-lab/gravity/server"
+	"net/http"
+)
+
+func init() {
+	server.Router().GET("/api/event/stats", func(c *gin.Context) {
+		c.JSON(http.StatusOK, event.Stats())
+	})
+	server.RegisterShutdownHook("event", 50, func(ctx context.Context) error {
+		event.DisableJournal()
+		return nil
+	})
+	server.RegisterReadinessCheck("event", checkBacklog)
+	_ = server.NewGaugeFunc("event_pending", "Number of events pending delivery to subscribers.", func() float64 {
+		pending := 0
+		for _, stats := range event.Stats() {
+			pending += stats.Pending
+		}
+		return float64(pending)
+	})
+	_ = server.NewGaugeFunc("event_dead_letters", "Number of stored dead letters.", func() float64 {
+		return float64(len(event.DeadLetters()))
+	})
+}
+
+func checkBacklog(ctx context.Context) error {
+	maxPending := config.GetInt("event.maxPending")
+	if maxPending <= 0 {
+		maxPending = 1000
+	}
+	for _, stats := range event.Stats() {
+		if stats.Pending > maxPending {
+			return fmt.Errorf("Topic %s has %d pending events. ", stats.Topic, stats.Pending)
+		}
+	}
+	return nil
+}
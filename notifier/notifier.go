@@ -1,6 +1,7 @@
 package notifier
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/infinit-lab/gravity/config"
 	"github.com/infinit-lab/gravity/controller"
@@ -32,8 +33,11 @@ func init() {
 	}
 	notifier.timer = time.NewTimer(time.Duration(age) * time.Second)
 	go notifier.updateSessionLoop()
-	notifier.subscriber, _ = event.SubscribeAll()
+	notifier.subscriber, _ = subscribeAll()
 	go notifier.eventLoop()
+	notifier.sessionSubscriber, _ = subscribeSession()
+	go notifier.sessionLoop()
+	server.RegisterShutdownHook("notifier", 100, notifier.shutdown)
 	server.Router().GET("/ws/notification", controller.SessionMiddle(), server.GenerateWebsocketHandlerFunc(notifier))
 }
 
@@ -44,6 +48,9 @@ type notifierHandler struct {
 	subscriber  event.Subscriber
 	filterMap   map[string]FilterFunc
 	filterMutex sync.Mutex
+
+	sessionSubscriber event.Subscriber
+	isShutdown        bool
 }
 
 func (n *notifierHandler) NewConnection(socket server.Websocket) {
@@ -122,6 +129,49 @@ func (n *notifierHandler) getFilter(topic string) (filter FilterFunc, ok bool) {
 	return
 }
 
+func subscribeAll() (event.Subscriber, error) {
+	return event.SubscribeWithOptions("", event.Options{
+		Filter: func(e *event.Event) bool {
+			return e.Topic != controller.TopicSession
+		},
+	})
+}
+
+func subscribeSession() (event.Subscriber, error) {
+	return event.SubscribeWithOptions(controller.TopicSession, event.Options{
+		Status: []string{model.StatusDeleted},
+	})
+}
+
+func (n *notifierHandler) sessionLoop() {
+	for {
+		e, ok := <-n.sessionSubscriber.Event()
+		if !ok {
+			printer.Error("quit...")
+			break
+		}
+		session, ok := e.Data.(*controller.Session)
+		if !ok {
+			continue
+		}
+		ws, ok := n.getWebsocket(session.Token)
+		if !ok {
+			continue
+		}
+		_ = ws.Close()
+	}
+	n.sessionSubscriber.Unsubscribe()
+	s, _ := subscribeSession()
+	n.socketMutex.Lock()
+	defer n.socketMutex.Unlock()
+	if n.isShutdown {
+		s.Unsubscribe()
+		return
+	}
+	n.sessionSubscriber = s
+	go n.sessionLoop()
+}
+
 func (n *notifierHandler) eventLoop() {
 	for {
 		e, ok := <-n.subscriber.Event()
@@ -129,51 +179,58 @@ func (n *notifierHandler) eventLoop() {
 			printer.Error("quit...")
 			break
 		}
-		switch e.Topic {
-		case controller.TopicSession:
-			if e.Status == model.StatusDeleted {
-				session, ok := e.Data.(*controller.Session)
-				if !ok {
-					continue
-				}
-				ws, ok := n.getWebsocket(session.Token)
-				if !ok {
-					continue
-				}
-				_ = ws.Close()
-			}
-		default:
-			tempEvent := *e
-			tempEvent.Context = nil
-			data, _ := json.Marshal(tempEvent)
+		tempEvent := *e
+		tempEvent.Context = nil
+		data, err := json.Marshal(tempEvent)
+		if err != nil {
+			printer.Error(err)
+			continue
+		}
 
-			tokenList := n.getTokenList()
-			for _, token := range tokenList {
-				filter, ok := n.getFilter(e.Topic)
-				if ok {
-					session, err := controller.GetSession(token)
-					if err != nil {
-						ws, ok := n.getWebsocket(token)
-						if ok {
-							_ = ws.Close()
-						}
-						continue
+		tokenList := n.getTokenList()
+		for _, token := range tokenList {
+			filter, ok := n.getFilter(e.Topic)
+			if ok {
+				session, err := controller.GetSession(token)
+				if err != nil {
+					ws, ok := n.getWebsocket(token)
+					if ok {
+						_ = ws.Close()
 					}
-					if filter(session, e) == false {
-						continue
-					}
-				}
-				ws, ok := n.getWebsocket(token)
-				if !ok {
 					continue
 				}
-				if err := ws.WriteMessage(data); err != nil {
-					printer.Error(err)
+				if filter(session, e) == false {
+					continue
 				}
 			}
+			ws, ok := n.getWebsocket(token)
+			if !ok {
+				continue
+			}
+			if err := ws.WriteMessage(data); err != nil {
+				printer.Error(err)
+			}
 		}
 	}
 	n.subscriber.Unsubscribe()
-	n.subscriber, _ = event.SubscribeAll()
+	s, _ := subscribeAll()
+	n.socketMutex.Lock()
+	defer n.socketMutex.Unlock()
+	if n.isShutdown {
+		s.Unsubscribe()
+		return
+	}
+	n.subscriber = s
 	go n.eventLoop()
 }
+
+func (n *notifierHandler) shutdown(ctx context.Context) error {
+	n.socketMutex.Lock()
+	n.isShutdown = true
+	subscriber := n.subscriber
+	sessionSubscriber := n.sessionSubscriber
+	n.socketMutex.Unlock()
+	subscriber.Unsubscribe()
+	sessionSubscriber.Unsubscribe()
+	return nil
+}
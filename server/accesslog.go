@@ -0,0 +1,158 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/infinit-lab/gravity/config"
+	"github.com/infinit-lab/gravity/printer"
+	uuid "github.com/satori/go.uuid"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	AccessLogCommon   string = "common"
+	AccessLogCombined string = "combined"
+	AccessLogJson     string = "json"
+	AccessLogOff      string = "off"
+)
+
+const RequestIdHeader string = "X-Request-Id"
+
+const maxRequestIdLength int = 128
+
+type accessRecord struct {
+	Time      string  `json:"time"`
+	Remote    string  `json:"remote"`
+	User      string  `json:"user"`
+	Method    string  `json:"method"`
+	Path      string  `json:"path"`
+	Proto     string  `json:"proto"`
+	Status    int     `json:"status"`
+	Bytes     int     `json:"bytes"`
+	Latency   float64 `json:"latency"`
+	Referer   string  `json:"referer"`
+	UserAgent string  `json:"userAgent"`
+	RequestId string  `json:"requestId"`
+}
+
+var accessLogWriter io.Writer
+var accessLogMutex sync.Mutex
+
+func SetAccessLogWriter(writer io.Writer) {
+	accessLogMutex.Lock()
+	defer accessLogMutex.Unlock()
+	accessLogWriter = writer
+}
+
+func isAccessLogExcluded(path string) bool {
+	excludes := config.GetStringList("server.accessLog.excludes")
+	if len(excludes) == 0 {
+		excludes = []string{"/healthz", "/readyz", "/metrics"}
+	}
+	for _, exclude := range excludes {
+		if path == exclude || strings.HasPrefix(path, strings.TrimSuffix(exclude, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func isValidRequestId(requestId string) bool {
+	if len(requestId) == 0 || len(requestId) > maxRequestIdLength {
+		return false
+	}
+	for _, r := range requestId {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '-' && r != '_' && r != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+func accessLogMiddle() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		requestId := c.GetHeader(RequestIdHeader)
+		if !isValidRequestId(requestId) {
+			requestId = strings.ReplaceAll(uuid.NewV4().String(), "-", "")
+		}
+		c.Set("RequestId", requestId)
+		c.Header(RequestIdHeader, requestId)
+
+		c.Next()
+
+		format := config.GetString("server.accessLog.format")
+		if format == AccessLogOff || isAccessLogExcluded(c.Request.URL.Path) {
+			return
+		}
+		record := accessRecord{
+			Time:      start.Format("2006-01-02 15:04:05"),
+			Remote:    ClientIp(c),
+			User:      c.GetString("Username"),
+			Method:    c.Request.Method,
+			Path:      c.Request.URL.RequestURI(),
+			Proto:     c.Request.Proto,
+			Status:    c.Writer.Status(),
+			Bytes:     c.Writer.Size(),
+			Latency:   time.Since(start).Seconds(),
+			Referer:   c.Request.Referer(),
+			UserAgent: c.Request.UserAgent(),
+			RequestId: requestId,
+		}
+		if record.Bytes < 0 {
+			record.Bytes = 0
+		}
+		writeAccessLog(formatAccessLog(format, &record, start))
+	}
+}
+
+var logFieldReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+func formatAccessLog(format string, record *accessRecord, start time.Time) string {
+	user := record.User
+	if len(user) == 0 {
+		user = "-"
+	}
+	common := fmt.Sprintf(`%s - %s [%s] "%s %s %s" %d %d`, record.Remote, user, start.Format("02/Jan/2006:15:04:05 -0700"),
+		record.Method, logFieldReplacer.Replace(record.Path), record.Proto, record.Status, record.Bytes)
+	switch format {
+	case AccessLogJson:
+		data, err := json.Marshal(record)
+		if err != nil {
+			printer.Error(err)
+			return ""
+		}
+		return string(data)
+	case AccessLogCombined:
+		return fmt.Sprintf(`%s "%s" "%s" %.6f %s`, common, logFieldReplacer.Replace(record.Referer), logFieldReplacer.Replace(record.UserAgent), record.Latency, record.RequestId)
+	default:
+		return fmt.Sprintf(`%s %.6f %s`, common, record.Latency, record.RequestId)
+	}
+}
+
+func writeAccessLog(line string) {
+	if len(line) == 0 {
+		return
+	}
+	accessLogMutex.Lock()
+	defer accessLogMutex.Unlock()
+	if accessLogWriter == nil {
+		printer.Trace(line)
+		return
+	}
+	if _, err := io.WriteString(accessLogWriter, line+"\n"); err != nil {
+		printer.Error(err)
+	}
+}
+
+type recoveryWriter struct {
+}
+
+func (w *recoveryWriter) Write(p []byte) (int, error) {
+	printer.Error(strings.TrimSpace(string(p)))
+	return len(p), nil
+}
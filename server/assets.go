@@ -0,0 +1,194 @@
+package server
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/infinit-lab/gravity/config"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+type cacheControl struct {
+	pattern string
+	value   string
+}
+
+var assetsFileSystem http.FileSystem
+var cacheControlList []*cacheControl
+var cacheControlMutex sync.Mutex
+
+func SetAssetsFileSystem(fs http.FileSystem) {
+	assetsFileSystem = fs
+}
+
+func SetCacheControl(pattern string, value string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return err
+	}
+	cacheControlMutex.Lock()
+	defer cacheControlMutex.Unlock()
+	for _, c := range cacheControlList {
+		if c.pattern == pattern {
+			c.value = value
+			return nil
+		}
+	}
+	cacheControlList = append(cacheControlList, &cacheControl{pattern: pattern, value: value})
+	return nil
+}
+
+func getCacheControl(name string) string {
+	cacheControlMutex.Lock()
+	defer cacheControlMutex.Unlock()
+	for _, c := range cacheControlList {
+		if ok, _ := path.Match(c.pattern, name); ok {
+			return c.value
+		}
+		if ok, _ := path.Match(c.pattern, path.Base(name)); ok {
+			return c.value
+		}
+	}
+	if path.Base(name) == "index.html" {
+		return "no-cache"
+	}
+	return ""
+}
+
+type assetsHandler struct {
+	fs http.FileSystem
+}
+
+func newAssetsHandler(fs http.FileSystem) http.Handler {
+	return &assetsHandler{fs: fs}
+}
+
+func (h *assetsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		name := path.Clean("/" + r.URL.Path)
+		if h.serveFile(w, r, name) {
+			return
+		}
+		if config.GetBool("server.spa.enable") && path.Ext(name) == "" && !isSpaExcluded(name) {
+			if h.serveFile(w, r, "/index.html") {
+				return
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusNotFound)
+	_, _ = w.Write([]byte(`{"message":"Not Found. ","result":false}`))
+}
+
+func isSpaExcluded(name string) bool {
+	excludes := config.GetStringList("server.spa.excludes")
+	if len(excludes) == 0 {
+		excludes = []string{"/api", "/ws"}
+	}
+	for _, exclude := range excludes {
+		exclude = strings.TrimSuffix(exclude, "/")
+		if name == exclude || strings.HasPrefix(name, exclude+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *assetsHandler) open(name string) (http.File, os.FileInfo, bool) {
+	f, err := h.fs.Open(name)
+	if err != nil {
+		return nil, nil, false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, nil, false
+	}
+	return f, info, true
+}
+
+func (h *assetsHandler) serveFile(w http.ResponseWriter, r *http.Request, name string) bool {
+	f, info, ok := h.open(name)
+	if !ok {
+		return false
+	}
+	if info.IsDir() {
+		_ = f.Close()
+		name = path.Join(name, "index.html")
+		f, info, ok = h.open(name)
+		if !ok {
+			return false
+		}
+		if info.IsDir() {
+			_ = f.Close()
+			return false
+		}
+	}
+
+	header := w.Header()
+	acceptEncoding := r.Header.Get("Accept-Encoding")
+	for _, encoding := range []struct {
+		name      string
+		extension string
+	}{{"br", ".br"}, {"gzip", ".gz"}} {
+		if !strings.Contains(acceptEncoding, encoding.name) {
+			continue
+		}
+		compressed, compressedInfo, ok := h.open(name + encoding.extension)
+		if !ok {
+			continue
+		}
+		if compressedInfo.IsDir() {
+			_ = compressed.Close()
+			continue
+		}
+		_ = f.Close()
+		f = compressed
+		info = compressedInfo
+		header.Set("Content-Encoding", encoding.name)
+		break
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	header.Add("Vary", "Accept-Encoding")
+
+	if contentType := mime.TypeByExtension(path.Ext(name)); len(contentType) != 0 {
+		header.Set("Content-Type", contentType)
+	}
+	if etag := generateETag(f, info); len(etag) != 0 {
+		header.Set("ETag", etag)
+	}
+	if value := getCacheControl(name); len(value) != 0 {
+		header.Set("Cache-Control", value)
+	}
+	http.ServeContent(w, r, name, info.ModTime(), f)
+	return true
+}
+
+func generateETag(f http.File, info os.FileInfo) string {
+	if !info.ModTime().IsZero() {
+		return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+	}
+	hash := sha1.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return ""
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return ""
+	}
+	return fmt.Sprintf(`"%x"`, hash.Sum(nil)[:8])
+}
+
+func noRoute(context *gin.Context) {
+	if fileHandler != nil {
+		fileHandler.ServeHTTP(context.Writer, context.Request)
+	} else {
+		context.JSON(http.StatusNotFound, gin.H{"result": false, "message": "Not Found. "})
+	}
+}
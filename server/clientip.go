@@ -0,0 +1,55 @@
+package server
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/infinit-lab/gravity/config"
+	"net"
+	"strings"
+)
+
+func ClientIp(c *gin.Context) string {
+	ip, _, err := net.SplitHostPort(strings.TrimSpace(c.Request.RemoteAddr))
+	if err != nil {
+		ip = c.Request.RemoteAddr
+	}
+	if !isTrustedProxy(ip) {
+		return ip
+	}
+	if forwarded := c.GetHeader("X-Forwarded-For"); len(forwarded) != 0 {
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if len(hop) == 0 {
+				continue
+			}
+			ip = hop
+			if !isTrustedProxy(hop) {
+				break
+			}
+		}
+		return ip
+	}
+	if realIp := strings.TrimSpace(c.GetHeader("X-Real-Ip")); len(realIp) != 0 {
+		return realIp
+	}
+	return ip
+}
+
+func isTrustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, proxy := range config.GetStringList("server.trustedProxies") {
+		if strings.Contains(proxy, "/") {
+			if _, network, err := net.ParseCIDR(proxy); err == nil && network.Contains(parsed) {
+				return true
+			}
+			continue
+		}
+		if p := net.ParseIP(proxy); p != nil && p.Equal(parsed) {
+			return true
+		}
+	}
+	return false
+}
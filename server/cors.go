@@ -0,0 +1,99 @@
+package server
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/infinit-lab/gravity/config"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+func allowedOrigins() []string {
+	return config.GetStringList("server.cors.origins")
+}
+
+func isOriginListed(origin string, origins []string) bool {
+	for _, o := range origins {
+		if strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func isOriginAllowed(origin string, origins []string) bool {
+	return isOriginListed("*", origins) || isOriginListed(origin, origins)
+}
+
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if len(origin) == 0 {
+		return true
+	}
+	origins := allowedOrigins()
+	if len(origins) == 0 {
+		return true
+	}
+	if isOriginAllowed(origin, origins) {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+func corsMiddle() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if len(origin) == 0 {
+			c.Next()
+			return
+		}
+		origins := allowedOrigins()
+		if len(origins) == 0 || !isOriginAllowed(origin, origins) {
+			c.Next()
+			return
+		}
+
+		header := c.Writer.Header()
+		if isOriginListed(origin, origins) {
+			header.Set("Access-Control-Allow-Origin", origin)
+			header.Add("Vary", "Origin")
+			if config.GetBool("server.cors.credentials") {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+		} else {
+			header.Set("Access-Control-Allow-Origin", "*")
+		}
+		exposeHeaders := config.GetStringList("server.cors.exposeHeaders")
+		if len(exposeHeaders) != 0 {
+			header.Set("Access-Control-Expose-Headers", strings.Join(exposeHeaders, ", "))
+		}
+
+		if c.Request.Method != http.MethodOptions || len(c.GetHeader("Access-Control-Request-Method")) == 0 {
+			c.Next()
+			return
+		}
+		methods := config.GetStringList("server.cors.methods")
+		if len(methods) == 0 {
+			methods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+		}
+		headers := config.GetStringList("server.cors.headers")
+		if len(headers) == 0 {
+			headers = []string{"Authorization", "Content-Type"}
+		}
+		header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		header.Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+		maxAge := config.GetInt("server.cors.maxAge")
+		if maxAge == 0 {
+			maxAge = 600
+		}
+		if maxAge > 0 {
+			header.Set("Access-Control-Max-Age", strconv.Itoa(maxAge))
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
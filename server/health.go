@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/infinit-lab/gravity/config"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	HealthUp   string = "up"
+	HealthDown string = "down"
+)
+
+type HealthCheckFunc func(ctx context.Context) error
+
+type CheckResult struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Latency string `json:"latency"`
+	Error   string `json:"error,omitempty"`
+}
+
+type HealthResult struct {
+	Status string         `json:"status"`
+	Checks []*CheckResult `json:"checks"`
+}
+
+type healthCheck struct {
+	name      string
+	readiness bool
+	check     HealthCheckFunc
+}
+
+var healthCheckList []*healthCheck
+var healthCheckMutex sync.Mutex
+var isShuttingDown int32
+
+func RegisterHealthCheck(name string, check HealthCheckFunc) {
+	registerHealthCheck(name, false, check)
+}
+
+func RegisterReadinessCheck(name string, check HealthCheckFunc) {
+	registerHealthCheck(name, true, check)
+}
+
+func registerHealthCheck(name string, readiness bool, check HealthCheckFunc) {
+	healthCheckMutex.Lock()
+	defer healthCheckMutex.Unlock()
+	for i, c := range healthCheckList {
+		if c.name == name {
+			healthCheckList = append(healthCheckList[:i:i], healthCheckList[i+1:]...)
+			break
+		}
+	}
+	healthCheckList = append(healthCheckList, &healthCheck{name: name, readiness: readiness, check: check})
+}
+
+func CheckHealth(readiness bool) *HealthResult {
+	healthCheckMutex.Lock()
+	var list []*healthCheck
+	for _, c := range healthCheckList {
+		if readiness || !c.readiness {
+			list = append(list, c)
+		}
+	}
+	healthCheckMutex.Unlock()
+
+	timeout := config.GetInt("server.health.timeout")
+	if timeout <= 0 {
+		timeout = 5
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	result := new(HealthResult)
+	result.Status = HealthUp
+	result.Checks = make([]*CheckResult, len(list))
+	var wg sync.WaitGroup
+	for i, c := range list {
+		wg.Add(1)
+		go func(i int, c *healthCheck) {
+			defer wg.Done()
+			result.Checks[i] = runHealthCheck(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+	if readiness && atomic.LoadInt32(&isShuttingDown) != 0 {
+		result.Checks = append(result.Checks, &CheckResult{
+			Name:    "server",
+			Status:  HealthDown,
+			Latency: "0s",
+			Error:   "Server is shutting down. ",
+		})
+	}
+	for _, c := range result.Checks {
+		if c.Status != HealthUp {
+			result.Status = HealthDown
+		}
+	}
+	return result
+}
+
+func runHealthCheck(ctx context.Context, c *healthCheck) *CheckResult {
+	start := time.Now()
+	errChan := make(chan error, 1)
+	go func() {
+		defer func() {
+			if e := recover(); e != nil {
+				errChan <- fmt.Errorf("%v", e)
+			}
+		}()
+		errChan <- c.check(ctx)
+	}()
+	var err error
+	select {
+	case err = <-errChan:
+	case <-ctx.Done():
+		err = errors.New("Health check is timeout. ")
+	}
+
+	result := new(CheckResult)
+	result.Name = c.name
+	result.Status = HealthUp
+	result.Latency = time.Since(start).String()
+	if err != nil {
+		result.Status = HealthDown
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func healthHandlerFunc(readiness bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result := CheckHealth(readiness)
+		if result.Status == HealthUp {
+			c.JSON(http.StatusOK, result)
+		} else {
+			c.JSON(http.StatusServiceUnavailable, result)
+		}
+	}
+}
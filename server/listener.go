@@ -0,0 +1,147 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"github.com/infinit-lab/gravity/config"
+	"github.com/infinit-lab/gravity/printer"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	NetworkTcp  string = "tcp"
+	NetworkUnix string = "unix"
+)
+
+type ListenerOptions struct {
+	Network  string
+	Address  string
+	Mode     os.FileMode
+	Prefixes []string
+	Handler  http.Handler
+}
+
+var listenerList []ListenerOptions
+var listenerMutex sync.Mutex
+
+func AddListener(options ListenerOptions) error {
+	if len(options.Network) == 0 {
+		options.Network = NetworkTcp
+	}
+	if options.Network != NetworkTcp && options.Network != NetworkUnix {
+		return errors.New("Invalid network " + options.Network + ". ")
+	}
+	if len(options.Address) == 0 {
+		return errors.New("Address is empty. ")
+	}
+	listenerMutex.Lock()
+	defer listenerMutex.Unlock()
+	listenerList = append(listenerList, options)
+	return nil
+}
+
+func configListeners() []ListenerOptions {
+	var list []ListenerOptions
+	mode, err := strconv.ParseUint(config.GetString("server.unixMode"), 8, 32)
+	if err != nil {
+		mode = 0
+	}
+	for _, address := range config.GetStringList("server.listen") {
+		options := ListenerOptions{Network: NetworkTcp, Address: address}
+		if strings.HasPrefix(address, "unix:") {
+			options.Network = NetworkUnix
+			options.Address = strings.TrimPrefix(address, "unix:")
+			options.Mode = os.FileMode(mode)
+		}
+		list = append(list, options)
+	}
+	return list
+}
+
+func (o *ListenerOptions) listen() (net.Listener, error) {
+	if o.Network != NetworkUnix {
+		return net.Listen(NetworkTcp, o.Address)
+	}
+	if info, err := os.Stat(o.Address); err == nil && info.Mode()&os.ModeSocket != 0 {
+		_ = os.Remove(o.Address)
+	}
+	l, err := net.Listen(NetworkUnix, o.Address)
+	if err != nil {
+		return nil, err
+	}
+	mode := o.Mode
+	if mode == 0 {
+		mode = 0660
+	}
+	if err := os.Chmod(o.Address, mode); err != nil {
+		_ = l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+func (o *ListenerOptions) handler() http.Handler {
+	handler := o.Handler
+	if handler == nil {
+		handler = router
+	}
+	if len(o.Prefixes) == 0 {
+		return handler
+	}
+	prefixes := o.Prefixes
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				handler.ServeHTTP(w, r)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"message":"Not Found. ","result":false}`))
+	})
+}
+
+func startListeners(tlsConfig *tls.Config) ([]*http.Server, error) {
+	listenerMutex.Lock()
+	list := append(configListeners(), listenerList...)
+	listenerMutex.Unlock()
+
+	var serverList []*http.Server
+	for i := range list {
+		options := list[i]
+		l, err := options.listen()
+		if err != nil {
+			printer.Error(err)
+			for _, s := range serverList {
+				_ = s.Close()
+			}
+			return nil, err
+		}
+		s := new(http.Server)
+		s.Addr = options.Address
+		s.Handler = options.handler()
+		if options.Network == NetworkTcp {
+			s.TLSConfig = tlsConfig
+		}
+		serverList = append(serverList, s)
+		go func() {
+			var err error
+			if s.TLSConfig != nil {
+				err = s.ServeTLS(l, "", "")
+			} else {
+				err = s.Serve(l)
+			}
+			if err != nil && err != http.ErrServerClosed {
+				printer.Error(err)
+			}
+		}()
+		printer.Trace("Listening on ", options.Network, " ", options.Address)
+	}
+	return serverList, nil
+}
@@ -0,0 +1,287 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/infinit-lab/gravity/printer"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	metricCounter   string = "counter"
+	metricGauge     string = "gauge"
+	metricHistogram string = "histogram"
+)
+
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type Counter interface {
+	Inc(labelValues ...string)
+	Add(value float64, labelValues ...string)
+}
+
+type Gauge interface {
+	Set(value float64, labelValues ...string)
+	Inc(labelValues ...string)
+	Dec(labelValues ...string)
+	Add(value float64, labelValues ...string)
+}
+
+type Histogram interface {
+	Observe(value float64, labelValues ...string)
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	counts      []uint64
+	count       uint64
+}
+
+type metric struct {
+	name       string
+	help       string
+	metricType string
+	labelNames []string
+	buckets    []float64
+	valueFunc  func() float64
+
+	mutex     sync.Mutex
+	seriesMap map[string]*series
+}
+
+var metricMap = make(map[string]*metric)
+var metricMutex sync.Mutex
+var metricNameRegexp = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+var labelNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+func NewCounter(name string, help string, labelNames ...string) (Counter, error) {
+	return registerMetric(name, help, metricCounter, nil, nil, labelNames)
+}
+
+func NewGauge(name string, help string, labelNames ...string) (Gauge, error) {
+	return registerMetric(name, help, metricGauge, nil, nil, labelNames)
+}
+
+func NewGaugeFunc(name string, help string, valueFunc func() float64) error {
+	if valueFunc == nil {
+		return errors.New("The value function is nil. ")
+	}
+	_, err := registerMetric(name, help, metricGauge, nil, valueFunc, nil)
+	return err
+}
+
+func NewHistogram(name string, help string, buckets []float64, labelNames ...string) (Histogram, error) {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	sorted := make([]float64, len(buckets))
+	copy(sorted, buckets)
+	sort.Float64s(sorted)
+	return registerMetric(name, help, metricHistogram, sorted, nil, labelNames)
+}
+
+func registerMetric(name string, help string, metricType string, buckets []float64, valueFunc func() float64, labelNames []string) (*metric, error) {
+	if !metricNameRegexp.MatchString(name) {
+		return nil, errors.New("Invalid metric name " + name + ". ")
+	}
+	for _, labelName := range labelNames {
+		if !labelNameRegexp.MatchString(labelName) || labelName == "le" {
+			return nil, errors.New("Invalid label name " + labelName + ". ")
+		}
+	}
+
+	metricMutex.Lock()
+	defer metricMutex.Unlock()
+	if _, ok := metricMap[name]; ok {
+		return nil, errors.New("Metric " + name + " is already registered. ")
+	}
+	m := new(metric)
+	m.name = name
+	m.help = help
+	m.metricType = metricType
+	m.labelNames = labelNames
+	m.buckets = buckets
+	m.valueFunc = valueFunc
+	m.seriesMap = make(map[string]*series)
+	metricMap[name] = m
+	return m, nil
+}
+
+func (m *metric) getSeries(labelValues []string) (*series, bool) {
+	if len(labelValues) != len(m.labelNames) {
+		printer.Error("Metric ", m.name, " expects ", len(m.labelNames), " label values, got ", len(labelValues), ". ")
+		return nil, false
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := m.seriesMap[key]
+	if !ok {
+		s = new(series)
+		s.labelValues = make([]string, len(labelValues))
+		copy(s.labelValues, labelValues)
+		if m.metricType == metricHistogram {
+			s.counts = make([]uint64, len(m.buckets))
+		}
+		m.seriesMap[key] = s
+	}
+	return s, true
+}
+
+func (m *metric) Inc(labelValues ...string) {
+	m.Add(1, labelValues...)
+}
+
+func (m *metric) Dec(labelValues ...string) {
+	m.Add(-1, labelValues...)
+}
+
+func (m *metric) Add(value float64, labelValues ...string) {
+	if m.metricType == metricCounter && value < 0 {
+		printer.Error("Counter ", m.name, " cannot decrease. ")
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if s, ok := m.getSeries(labelValues); ok {
+		s.value += value
+	}
+}
+
+func (m *metric) Set(value float64, labelValues ...string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if s, ok := m.getSeries(labelValues); ok {
+		s.value = value
+	}
+}
+
+func (m *metric) Observe(value float64, labelValues ...string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	s, ok := m.getSeries(labelValues)
+	if !ok {
+		return
+	}
+	for i, bucket := range m.buckets {
+		if value <= bucket {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.value += value
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func formatLabels(names []string, values []string, extraName string, extraValue string) string {
+	if len(names) == 0 && len(extraName) == 0 {
+		return ""
+	}
+	var pairs []string
+	for i, name := range names {
+		pairs = append(pairs, name+`="`+labelValueReplacer.Replace(values[i])+`"`)
+	}
+	if len(extraName) != 0 {
+		pairs = append(pairs, extraName+`="`+extraValue+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func (m *metric) write(buffer *bytes.Buffer) {
+	if len(m.help) != 0 {
+		_, _ = fmt.Fprintf(buffer, "# HELP %s %s\n", m.name, helpReplacer.Replace(m.help))
+	}
+	_, _ = fmt.Fprintf(buffer, "# TYPE %s %s\n", m.name, m.metricType)
+	if m.valueFunc != nil {
+		_, _ = fmt.Fprintf(buffer, "%s %s\n", m.name, formatFloat(m.valueFunc()))
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	keys := make([]string, 0, len(m.seriesMap))
+	for key := range m.seriesMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := m.seriesMap[key]
+		if m.metricType != metricHistogram {
+			_, _ = fmt.Fprintf(buffer, "%s%s %s\n", m.name, formatLabels(m.labelNames, s.labelValues, "", ""), formatFloat(s.value))
+			continue
+		}
+		for i, bucket := range m.buckets {
+			_, _ = fmt.Fprintf(buffer, "%s_bucket%s %d\n", m.name, formatLabels(m.labelNames, s.labelValues, "le", formatFloat(bucket)), s.counts[i])
+		}
+		labels := formatLabels(m.labelNames, s.labelValues, "", "")
+		_, _ = fmt.Fprintf(buffer, "%s_bucket%s %d\n", m.name, formatLabels(m.labelNames, s.labelValues, "le", "+Inf"), s.count)
+		_, _ = fmt.Fprintf(buffer, "%s_sum%s %s\n", m.name, labels, formatFloat(s.value))
+		_, _ = fmt.Fprintf(buffer, "%s_count%s %d\n", m.name, labels, s.count)
+	}
+}
+
+func WriteMetrics(buffer *bytes.Buffer) {
+	metricMutex.Lock()
+	list := make([]*metric, 0, len(metricMap))
+	for _, m := range metricMap {
+		list = append(list, m)
+	}
+	metricMutex.Unlock()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].name < list[j].name
+	})
+	for _, m := range list {
+		m.write(buffer)
+	}
+}
+
+var requestCounter Counter
+var requestDuration Histogram
+var websocketGauge Gauge
+
+func initMetrics() {
+	requestCounter, _ = NewCounter("http_requests_total", "Total number of HTTP requests.", "method", "route", "status")
+	requestDuration, _ = NewHistogram("http_request_duration_seconds", "Duration of HTTP requests in seconds.", nil, "method", "route")
+	websocketGauge, _ = NewGauge("websocket_connections", "Number of open websocket connections.")
+}
+
+func metricsMiddle() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if len(route) == 0 {
+			route = "unmatched"
+		}
+		requestCounter.Inc(c.Request.Method, route, strconv.Itoa(c.Writer.Status()))
+		requestDuration.Observe(time.Since(start).Seconds(), c.Request.Method, route)
+	}
+}
+
+func metricsHandler(c *gin.Context) {
+	var buffer bytes.Buffer
+	WriteMetrics(&buffer)
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", buffer.Bytes())
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/infinit-lab/gravity/printer"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	ProxyUserIdHeader   string = "X-Gravity-User-Id"
+	ProxyUsernameHeader string = "X-Gravity-Username"
+)
+
+type proxyIdentityKey struct{}
+
+type proxyIdentity struct {
+	userId   string
+	username string
+}
+
+func SetProxyIdentity(c *gin.Context, userId string, username string) {
+	identity := &proxyIdentity{userId: userId, username: username}
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), proxyIdentityKey{}, identity))
+}
+
+type ProxyOptions struct {
+	StripPrefix  bool
+	Rewrite      string
+	PreserveHost bool
+	Headers      map[string]string
+	Timeout      time.Duration
+	Middle       []gin.HandlerFunc
+}
+
+func Proxy(prefix string, target string, options ProxyOptions) error {
+	u, err := url.Parse(target)
+	if err != nil {
+		printer.Error(err)
+		return err
+	}
+	if len(u.Scheme) == 0 || len(u.Host) == 0 {
+		return errors.New("Invalid target " + target + ". ")
+	}
+	prefix = "/" + strings.Trim(prefix, "/")
+	if prefix == "/" {
+		return errors.New("Prefix is empty. ")
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = 30 * time.Second
+	}
+
+	transport := new(http.Transport)
+	transport.Proxy = http.ProxyFromEnvironment
+	transport.DialContext = (&net.Dialer{Timeout: options.Timeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.ResponseHeaderTimeout = options.Timeout
+	transport.TLSHandshakeTimeout = options.Timeout
+	transport.MaxIdleConnsPerHost = 16
+	transport.IdleConnTimeout = 90 * time.Second
+
+	proxy := new(httputil.ReverseProxy)
+	proxy.Transport = transport
+	proxy.Director = func(r *http.Request) {
+		path := r.URL.Path
+		if options.StripPrefix || len(options.Rewrite) != 0 {
+			path = options.Rewrite + strings.TrimPrefix(path, prefix)
+		}
+		r.URL.Scheme = u.Scheme
+		r.URL.Host = u.Host
+		r.URL.Path = joinPath(u.Path, path)
+		r.URL.RawPath = ""
+		query := r.URL.Query()
+		if _, ok := query["token"]; ok {
+			query.Del("token")
+			r.URL.RawQuery = query.Encode()
+		}
+		if len(u.RawQuery) == 0 || len(r.URL.RawQuery) == 0 {
+			r.URL.RawQuery = u.RawQuery + r.URL.RawQuery
+		} else {
+			r.URL.RawQuery = u.RawQuery + "&" + r.URL.RawQuery
+		}
+		r.Header.Set("X-Forwarded-Host", r.Host)
+		if r.TLS != nil {
+			r.Header.Set("X-Forwarded-Proto", "https")
+		} else {
+			r.Header.Set("X-Forwarded-Proto", "http")
+		}
+		if !options.PreserveHost {
+			r.Host = u.Host
+		}
+		r.Header.Del("Authorization")
+		r.Header.Del(ProxyUserIdHeader)
+		r.Header.Del(ProxyUsernameHeader)
+		if identity, ok := r.Context().Value(proxyIdentityKey{}).(*proxyIdentity); ok {
+			r.Header.Set(ProxyUserIdHeader, identity.userId)
+			r.Header.Set(ProxyUsernameHeader, identity.username)
+		}
+		if _, ok := r.Header["User-Agent"]; !ok {
+			r.Header.Set("User-Agent", "")
+		}
+		for key, value := range options.Headers {
+			r.Header.Set(key, value)
+		}
+	}
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		printer.Error("Failed to proxy ", r.URL.String(), ". error: ", err)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusBadGateway)
+		_, _ = w.Write([]byte(`{"result":false,"error":"Bad Gateway"}`))
+	}
+
+	var handlers []gin.HandlerFunc
+	handlers = append(handlers, options.Middle...)
+	handlers = append(handlers, func(c *gin.Context) {
+		if requestId := c.GetString("RequestId"); len(requestId) != 0 {
+			c.Request.Header.Set(RequestIdHeader, requestId)
+		}
+		proxy.ServeHTTP(c.Writer, c.Request)
+	})
+	path := prefix + "/*proxyPath"
+	if err := checkRoute(path); err != nil {
+		printer.Error(err)
+		return err
+	}
+	router.Any(path, handlers...)
+	return nil
+}
+
+func checkRoute(path string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New(fmt.Sprint("Failed to register route ", path, ". error: ", r, ". "))
+		}
+	}()
+	noop := func(c *gin.Context) {}
+	temp := gin.New()
+	for _, route := range router.Routes() {
+		temp.Handle(route.Method, route.Path, noop)
+	}
+	temp.Any(path, noop)
+	return nil
+}
+
+func joinPath(a string, b string) string {
+	if len(b) == 0 {
+		b = "/"
+	}
+	aSlash := strings.HasSuffix(a, "/")
+	bSlash := strings.HasPrefix(b, "/")
+	switch {
+	case aSlash && bSlash:
+		return a + b[1:]
+	case !aSlash && !bSlash:
+		return a + "/" + b
+	}
+	return a + b
+}
@@ -8,7 +8,10 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/infinit-lab/gravity/config"
 	"github.com/infinit-lab/gravity/printer"
+	"net"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,39 +21,128 @@ func Router() *gin.Engine {
 
 func Run() error {
 	defer func() {
+		serverMutex.Lock()
+		r := redirectServer
+		serverList := listenerServerList
 		server = nil
+		redirectServer = nil
+		listenerServerList = nil
+		serverMutex.Unlock()
+		if r != nil {
+			_ = r.Close()
+		}
+		for _, l := range serverList {
+			_ = l.Close()
+		}
 		fileHandler = nil
 	}()
 	port := config.GetInt("server.port")
 	if port == 0 {
 		port = 8080
 	}
-	server = new(http.Server)
-	server.Addr = fmt.Sprintf(":%d", port)
-	server.Handler = router
+	s := new(http.Server)
+	s.Addr = fmt.Sprintf(":%d", port)
+	s.Handler = router
 
-	assets := config.GetString("server.assets")
-	if len(assets) == 0 {
-		assets = "./assets"
+	if assetsFileSystem != nil {
+		fileHandler = newAssetsHandler(assetsFileSystem)
+	} else {
+		fileHandler = newAssetsHandler(http.Dir(GetAssetsPath()))
+	}
+	router.NoRoute(noRoute)
+
+	tlsConfig, err := tlsConfig()
+	if err != nil {
+		printer.Error(err)
+		return err
+	}
+	s.TLSConfig = tlsConfig
+	l, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		printer.Error(err)
+		return err
+	}
+	serverList, err := startListeners(tlsConfig)
+	if err != nil {
+		_ = l.Close()
+		return err
+	}
+	done := make(chan struct{})
+	atomic.StoreInt32(&isShuttingDown, 0)
+	serverMutex.Lock()
+	server = s
+	listenerServerList = serverList
+	shutdownDone = done
+	serverMutex.Unlock()
+
+	if !config.GetBool("server.ignoreSignal") {
+		stop := handleSignal()
+		defer stop()
 	}
-	fileHandler = http.FileServer(http.Dir(assets))
-	router.NoRoute(func(context *gin.Context) {
-		if fileHandler != nil {
-			fileHandler.ServeHTTP(context.Writer, context.Request)
-		} else {
-			context.JSON(http.StatusNotFound, gin.H{"result": false, "message": "Not Found. "})
+
+	if tlsConfig == nil {
+		err = s.Serve(l)
+	} else {
+		redirectPort := config.GetInt("server.tls.redirectPort")
+		if redirectPort != 0 {
+			r := newRedirectServer(redirectPort, port)
+			serverMutex.Lock()
+			redirectServer = r
+			serverMutex.Unlock()
+			go func() {
+				if err := r.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					printer.Error(err)
+				}
+			}()
 		}
-	})
-	return server.ListenAndServe()
+		err = s.ServeTLS(l, "", "")
+	}
+	if err == http.ErrServerClosed {
+		<-done
+		return nil
+	}
+	return err
 }
 
 func Shutdown() error {
-	if server == nil {
+	serverMutex.Lock()
+	s := server
+	r := redirectServer
+	serverList := listenerServerList
+	done := shutdownDone
+	server = nil
+	redirectServer = nil
+	listenerServerList = nil
+	serverMutex.Unlock()
+	if s == nil {
 		return nil
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer close(done)
+	atomic.StoreInt32(&isShuttingDown, 1)
+
+	timeout := config.GetInt("server.drainTimeout")
+	if timeout == 0 {
+		timeout = 5
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
 	defer cancel()
-	return server.Shutdown(ctx)
+	if r != nil {
+		if err := r.Shutdown(ctx); err != nil {
+			printer.Error(err)
+		}
+	}
+	for _, l := range serverList {
+		if err := l.Shutdown(ctx); err != nil {
+			printer.Error(err)
+		}
+	}
+	err := s.Shutdown(ctx)
+	if err != nil {
+		printer.Error(err)
+	}
+	closeWebsockets()
+	runShutdownHooks(ctx)
+	return err
 }
 
 func GetAssetsPath() string {
@@ -87,77 +179,149 @@ func GenerateWebsocketHandlerFunc(handler WebsocketHandler) gin.HandlerFunc {
 			printer.Error(err)
 			return
 		}
-		w := websocketImpl{
-			ws:               ws,
-			context:          context,
-			isClose:          false,
-			writeMessageChan: make(chan []byte),
-			writeBytesChan:   make(chan []byte),
-		}
-
-		go func() {
-			defer func() {
-				if err := recover(); err != nil {
-					printer.Error(err)
-				}
-			}()
-			for !w.isClose {
-				select {
-				case message, ok := <-w.writeMessageChan:
-					if !ok {
-						return
-					}
-					if err := w.ws.WriteMessage(websocket.TextMessage, message); err != nil {
-						printer.Error(err)
-					}
-				case bytes, ok := <-w.writeBytesChan:
-					if !ok {
-						return
-					}
-					if err := w.ws.WriteMessage(websocket.BinaryMessage, bytes); err != nil {
-						printer.Error(err)
-					}
-				}
-			}
-		}()
-		handler.NewConnection(&w)
+		w := newWebsocket(ws, context)
+		go w.writeLoop()
+		addWebsocket(w)
+		handler.NewConnection(w)
 		for {
 			messageType, bytes, err := w.ws.ReadMessage()
 			if err != nil {
 				break
 			}
+			w.extendReadDeadline()
 			switch messageType {
 			case websocket.TextMessage:
-				go handler.ReadMessage(&w, bytes)
+				go handler.ReadMessage(w, bytes)
 			case websocket.BinaryMessage:
-				go handler.ReadBytes(&w, bytes)
+				go handler.ReadBytes(w, bytes)
 			}
 		}
-		w.isClose = true
-		close(w.writeMessageChan)
-		close(w.writeBytesChan)
+		w.closeOnce.Do(func() {
+			close(w.closeChan)
+		})
+		<-w.writeDone
 		_ = w.ws.Close()
-		handler.Disconnected(&w)
+		removeWebsocket(w)
+		handler.Disconnected(w)
 	}
 }
 
 var router *gin.Engine
 var server *http.Server
+var redirectServer *http.Server
+var listenerServerList []*http.Server
+var shutdownDone chan struct{}
+var serverMutex sync.Mutex
 var upgrader websocket.Upgrader
 var fileHandler http.Handler
 
 func init() {
 	gin.SetMode(gin.ReleaseMode)
-	upgrader.CheckOrigin = func(r *http.Request) bool { return true }
-	router = gin.Default()
+	upgrader.CheckOrigin = checkOrigin
+	router = gin.New()
+	router.Use(accessLogMiddle(), gin.RecoveryWithWriter(new(recoveryWriter)))
+	initMetrics()
+	router.Use(metricsMiddle())
+	router.Use(corsMiddle())
+	router.GET("/healthz", healthHandlerFunc(false))
+	router.GET("/readyz", healthHandlerFunc(true))
+	router.GET("/metrics", metricsHandler)
+}
+
+type websocketMessage struct {
+	messageType int
+	data        []byte
 }
 
 type websocketImpl struct {
-	ws               *websocket.Conn
-	context          *gin.Context
-	isClose          bool
-	writeMessageChan chan []byte
-	writeBytesChan   chan []byte
+	ws           *websocket.Conn
+	context      *gin.Context
+	sendChan     chan *websocketMessage
+	closeChan    chan struct{}
+	closeOnce    sync.Once
+	writeDone    chan struct{}
+	pingInterval time.Duration
+	pongTimeout  time.Duration
+	writeTimeout time.Duration
+}
+
+func newWebsocket(ws *websocket.Conn, context *gin.Context) *websocketImpl {
+	w := new(websocketImpl)
+	w.ws = ws
+	w.context = context
+	w.closeChan = make(chan struct{})
+	w.writeDone = make(chan struct{})
+
+	queueSize := config.GetInt("server.websocket.sendQueue")
+	if queueSize <= 0 {
+		queueSize = 64
+	}
+	w.sendChan = make(chan *websocketMessage, queueSize)
+	pingInterval := config.GetInt("server.websocket.pingInterval")
+	if pingInterval == 0 {
+		pingInterval = 30
+	}
+	w.pingInterval = time.Duration(pingInterval) * time.Second
+	pongTimeout := config.GetInt("server.websocket.pongTimeout")
+	if pongTimeout <= 0 {
+		pongTimeout = pingInterval * 2
+	}
+	w.pongTimeout = time.Duration(pongTimeout) * time.Second
+	writeTimeout := config.GetInt("server.websocket.writeTimeout")
+	if writeTimeout <= 0 {
+		writeTimeout = 10
+	}
+	w.writeTimeout = time.Duration(writeTimeout) * time.Second
+	maxMessageSize := config.GetInt("server.websocket.maxMessageSize")
+	if maxMessageSize == 0 {
+		maxMessageSize = 1024 * 1024
+	}
+	if maxMessageSize > 0 {
+		ws.SetReadLimit(int64(maxMessageSize))
+	}
+
+	w.extendReadDeadline()
+	ws.SetPongHandler(func(string) error {
+		w.extendReadDeadline()
+		return nil
+	})
+	return w
+}
+
+func (w *websocketImpl) extendReadDeadline() {
+	if w.pingInterval <= 0 {
+		return
+	}
+	_ = w.ws.SetReadDeadline(time.Now().Add(w.pongTimeout))
+}
+
+func (w *websocketImpl) writeLoop() {
+	defer close(w.writeDone)
+	var pingChan <-chan time.Time
+	if w.pingInterval > 0 {
+		ticker := time.NewTicker(w.pingInterval)
+		defer ticker.Stop()
+		pingChan = ticker.C
+	}
+	for {
+		select {
+		case message := <-w.sendChan:
+			_ = w.ws.SetWriteDeadline(time.Now().Add(w.writeTimeout))
+			if err := w.ws.WriteMessage(message.messageType, message.data); err != nil {
+				printer.Error(err)
+				_ = w.ws.Close()
+				return
+			}
+		case <-pingChan:
+			if err := w.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(w.writeTimeout)); err != nil {
+				printer.Error(err)
+				_ = w.ws.Close()
+				return
+			}
+		case <-w.closeChan:
+			return
+		}
+	}
 }
 
 func (w *websocketImpl) Socket() *websocket.Conn {
@@ -168,35 +332,44 @@ func (w *websocketImpl) Context() *gin.Context {
 	return w.context
 }
 
-func (w *websocketImpl) WriteMessage(message []byte) error {
-	if w.isClose {
+func (w *websocketImpl) send(messageType int, data []byte) error {
+	select {
+	case <-w.closeChan:
 		return errors.New("The websocket is closed. ")
+	default:
 	}
-	defer func() {
-		if err := recover(); err != nil {
-			printer.Error(err)
-		}
-	}()
-	w.writeMessageChan <- message
-	return nil
+	select {
+	case w.sendChan <- &websocketMessage{messageType: messageType, data: data}:
+		return nil
+	case <-w.closeChan:
+		return errors.New("The websocket is closed. ")
+	default:
+		return errors.New("The send queue of websocket is full. ")
+	}
+}
+
+func (w *websocketImpl) WriteMessage(message []byte) error {
+	return w.send(websocket.TextMessage, message)
 }
 
 func (w *websocketImpl) WriteBytes(bytes []byte) error {
-	if w.isClose {
-		return errors.New("The websocket is closed. ")
-	}
-	defer func() {
-		if err := recover(); err != nil {
-			printer.Error(err)
-		}
-	}()
-	w.writeBytesChan <- bytes
-	return nil
+	return w.send(websocket.BinaryMessage, bytes)
 }
 
 func (w *websocketImpl) Close() error {
-	if w.isClose {
+	return w.closeWithCode(websocket.CloseNormalClosure, "")
+}
+
+func (w *websocketImpl) closeWithCode(code int, text string) error {
+	isClosed := true
+	w.closeOnce.Do(func() {
+		close(w.closeChan)
+		isClosed = false
+	})
+	if isClosed {
 		return errors.New("The websocket is closed. ")
 	}
+	message := websocket.FormatCloseMessage(code, text)
+	_ = w.ws.WriteControl(websocket.CloseMessage, message, time.Now().Add(w.writeTimeout))
 	return w.ws.Close()
 }
@@ -1,13 +1,34 @@
 package server
 
 import (
-	"device_framework/config"
-	"device_framework/printer"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"github.com/infinit-lab/gravity/config"
+	"github.com/infinit-lab/gravity/printer"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 type websocketHandler struct {
@@ -49,6 +70,7 @@ func TestWebsocket(t *testing.T) {
 			printer.Error(err)
 		}
 	}()
+	time.Sleep(100 * time.Millisecond)
 
 	u := url.URL{
 		Scheme: "ws",
@@ -82,3 +104,694 @@ func TestWebsocket(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func generateCertificate(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		parent = template
+		parentKey = key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, _ := x509.ParseCertificate(der)
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+	return certificate, key,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+func TestTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gravity_tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	ca, caKey, caPem, _ := generateCertificate(t, "ca", nil, nil)
+	_, _, serverPem, serverKeyPem := generateCertificate(t, "server", ca, caKey)
+	_, _, clientPem, clientKeyPem := generateCertificate(t, "client", ca, caKey)
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	caFile := filepath.Join(dir, "ca.crt")
+	_ = ioutil.WriteFile(certFile, serverPem, 0600)
+	_ = ioutil.WriteFile(keyFile, serverKeyPem, 0600)
+	_ = ioutil.WriteFile(caFile, caPem, 0600)
+
+	l, err := newCertificateLoader(certFile, keyFile, caFile, "")
+	if err != nil {
+		t.Fatal("Failed to newCertificateLoader. error: ", err)
+	}
+	l.interval = 0
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	s.TLS = l.config()
+	s.StartTLS()
+	defer s.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	clientCertificate, _ := tls.X509KeyPair(clientPem, clientKeyPem)
+	newClient := func(certificates []tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: roots, Certificates: certificates},
+			DisableKeepAlives: true,
+		}}
+	}
+
+	if _, err := newClient(nil).Get(s.URL); err == nil {
+		t.Fatal("Client without certificate should be rejected. ")
+	}
+	response, err := newClient([]tls.Certificate{clientCertificate}).Get(s.URL)
+	if err != nil {
+		t.Fatal("Failed to Get. error: ", err)
+	}
+	body, _ := ioutil.ReadAll(response.Body)
+	_ = response.Body.Close()
+	if string(body) != "client" {
+		t.Fatal("Unexpected peer ", string(body))
+	}
+	serial := response.TLS.PeerCertificates[0].SerialNumber
+
+	conn, err := tls.Dial("tcp", s.Listener.Addr().String(), &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{clientCertificate}, NextProtos: []string{"h2", "http/1.1"}})
+	if err != nil {
+		t.Fatal("Failed to Dial. error: ", err)
+	}
+	protocol := conn.ConnectionState().NegotiatedProtocol
+	_ = conn.Close()
+	if protocol != "h2" {
+		t.Fatal("HTTP/2 should be negotiated, not ", protocol)
+	}
+
+	_, _, serverPem, serverKeyPem = generateCertificate(t, "server", ca, caKey)
+	_ = ioutil.WriteFile(certFile, serverPem, 0600)
+	_ = ioutil.WriteFile(keyFile, serverKeyPem, 0600)
+	future := time.Now().Add(time.Minute)
+	_ = os.Chtimes(certFile, future, future)
+	response, err = newClient([]tls.Certificate{clientCertificate}).Get(s.URL)
+	if err != nil {
+		t.Fatal("Failed to Get. error: ", err)
+	}
+	_ = response.Body.Close()
+	if response.TLS.PeerCertificates[0].SerialNumber.Cmp(serial) == 0 {
+		t.Fatal("Certificate should be reloaded. ")
+	}
+
+	recorder := httptest.NewRecorder()
+	newRedirectServer(8080, 8443).Handler.ServeHTTP(recorder, httptest.NewRequest("GET", "http://127.0.0.1:8080/api/test?a=1", nil))
+	if recorder.Code != http.StatusMovedPermanently || recorder.Header().Get("Location") != "https://127.0.0.1:8443/api/test?a=1" {
+		t.Fatal("Unexpected redirect ", recorder.Code, recorder.Header().Get("Location"))
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	var order []string
+	RegisterShutdownHook("low", 0, func(ctx context.Context) error {
+		order = append(order, "low")
+		return nil
+	})
+	RegisterShutdownHook("high", 10, func(ctx context.Context) error {
+		order = append(order, "high")
+		return errors.New("Hook failed. ")
+	})
+	RegisterShutdownHook("panic", 5, func(ctx context.Context) error {
+		panic("hook panic")
+	})
+	Router().GET("/ws/shutdown", GenerateWebsocketHandlerFunc(new(websocketHandler)))
+
+	os.Args = append(os.Args, "server.port=8082")
+	config.LoadArgs()
+	result := make(chan error, 1)
+	go func() {
+		result <- Run()
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:8082/ws/shutdown", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	if err := Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-result; err != nil {
+		t.Fatal("Run should return nil after shutdown. error: ", err)
+	}
+	_, _, err = conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Fatal("Websocket should receive close frame. error: ", err)
+	}
+	if len(order) != 2 || order[0] != "high" || order[1] != "low" {
+		t.Fatal("Unexpected hook order ", order)
+	}
+}
+
+type heartbeatHandler struct {
+	websocketHandler
+	disconnected chan bool
+}
+
+func (h *heartbeatHandler) Disconnected(socket Websocket) {
+	h.disconnected <- true
+}
+
+func TestWebsocketHeartbeat(t *testing.T) {
+	handler := &heartbeatHandler{disconnected: make(chan bool, 2)}
+	Router().GET("/ws/heartbeat", GenerateWebsocketHandlerFunc(handler))
+
+	os.Args = append(os.Args, "server.port=8083", "server.websocket.pingInterval=1", "server.websocket.maxMessageSize=16")
+	config.LoadArgs()
+	result := make(chan error, 1)
+	go func() {
+		result <- Run()
+	}()
+	time.Sleep(100 * time.Millisecond)
+	defer func() {
+		_ = Shutdown()
+		<-result
+	}()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:8083/ws/heartbeat", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	_ = conn.WriteMessage(websocket.TextMessage, []byte("0123456789abcdef0123456789abcdef"))
+	_, _, err = conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Fatal("Oversized message should be rejected. error: ", err)
+	}
+	<-handler.disconnected
+
+	silent, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:8083/ws/heartbeat", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = silent.Close()
+	}()
+	select {
+	case <-handler.disconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Dead peer should be disconnected. ")
+	}
+}
+
+func TestCors(t *testing.T) {
+	os.Args = append(os.Args, "server.cors.origins=http://127.0.0.1:3000, http://localhost:3000", "server.cors.credentials=true")
+	config.LoadArgs()
+	Router().GET("/api/cors", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	request := httptest.NewRequest(http.MethodOptions, "/api/cors", nil)
+	request.Header.Set("Origin", "http://localhost:3000")
+	request.Header.Set("Access-Control-Request-Method", "GET")
+	recorder := httptest.NewRecorder()
+	Router().ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusNoContent ||
+		recorder.Header().Get("Access-Control-Allow-Origin") != "http://localhost:3000" ||
+		recorder.Header().Get("Access-Control-Allow-Credentials") != "true" ||
+		len(recorder.Header().Get("Access-Control-Allow-Methods")) == 0 {
+		t.Fatal("Unexpected preflight response ", recorder.Code, recorder.Header())
+	}
+
+	request = httptest.NewRequest(http.MethodGet, "/api/cors", nil)
+	request.Header.Set("Origin", "http://evil.com")
+	recorder = httptest.NewRecorder()
+	Router().ServeHTTP(recorder, request)
+	if len(recorder.Header().Get("Access-Control-Allow-Origin")) != 0 {
+		t.Fatal("Origin should not be allowed. ")
+	}
+
+	request = httptest.NewRequest(http.MethodGet, "/ws", nil)
+	request.Host = "127.0.0.1:8080"
+	request.Header.Set("Origin", "http://evil.com")
+	if checkOrigin(request) {
+		t.Fatal("Websocket origin should be rejected. ")
+	}
+	request.Header.Set("Origin", "http://127.0.0.1:8080")
+	if !checkOrigin(request) {
+		t.Fatal("Same origin should be accepted. ")
+	}
+
+	os.Args = append(os.Args, "server.cors.origins=*, http://localhost:3000")
+	config.LoadArgs()
+	request = httptest.NewRequest(http.MethodGet, "/api/cors", nil)
+	request.Header.Set("Origin", "http://evil.com")
+	recorder = httptest.NewRecorder()
+	Router().ServeHTTP(recorder, request)
+	if recorder.Header().Get("Access-Control-Allow-Origin") != "*" ||
+		len(recorder.Header().Get("Access-Control-Allow-Credentials")) != 0 {
+		t.Fatal("Wildcard origin must not allow credentials ", recorder.Header())
+	}
+	request.Header.Set("Origin", "http://localhost:3000")
+	recorder = httptest.NewRecorder()
+	Router().ServeHTTP(recorder, request)
+	if recorder.Header().Get("Access-Control-Allow-Origin") != "http://localhost:3000" ||
+		recorder.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Fatal("Listed origin should allow credentials ", recorder.Header())
+	}
+	os.Args = append(os.Args, "server.cors.origins=http://127.0.0.1:3000, http://localhost:3000")
+	config.LoadArgs()
+}
+
+func TestAssets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gravity_assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	_ = ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte("<html></html>"), 0600)
+	_ = ioutil.WriteFile(filepath.Join(dir, "app.js"), []byte("console.log(1)"), 0600)
+	_ = ioutil.WriteFile(filepath.Join(dir, "app.js.gz"), []byte("gzip"), 0600)
+	if err := SetCacheControl("*.js", "public, max-age=31536000"); err != nil {
+		t.Fatal(err)
+	}
+	os.Args = append(os.Args, "server.spa.enable=true")
+	config.LoadArgs()
+	handler := newAssetsHandler(http.Dir(dir))
+
+	get := func(target string, header map[string]string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, target, nil)
+		for key, value := range header {
+			request.Header.Set(key, value)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	recorder := get("/app.js", map[string]string{"Accept-Encoding": "gzip, deflate"})
+	if recorder.Body.String() != "gzip" || recorder.Header().Get("Content-Encoding") != "gzip" ||
+		!strings.HasPrefix(recorder.Header().Get("Content-Type"), "application/javascript") && !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/javascript") ||
+		recorder.Header().Get("Cache-Control") != "public, max-age=31536000" {
+		t.Fatal("Unexpected precompressed response ", recorder.Header(), recorder.Body.String())
+	}
+	if get("/app.js", nil).Body.String() != "console.log(1)" {
+		t.Fatal("Plain file should be served without Accept-Encoding. ")
+	}
+	etag := recorder.Header().Get("ETag")
+	if len(etag) == 0 {
+		t.Fatal("ETag should be set. ")
+	}
+	if get("/app.js", map[string]string{"Accept-Encoding": "gzip", "If-None-Match": etag}).Code != http.StatusNotModified {
+		t.Fatal("Matched ETag should return 304. ")
+	}
+
+	recorder = get("/devices/1", nil)
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "<html></html>" || recorder.Header().Get("Cache-Control") != "no-cache" {
+		t.Fatal("Client route should fall back to index.html. ", recorder.Code)
+	}
+	if get("/api/devices", nil).Code != http.StatusNotFound {
+		t.Fatal("API path should not fall back to index.html. ")
+	}
+	if get("/missing.js", nil).Code != http.StatusNotFound {
+		t.Fatal("Missing file should return 404. ")
+	}
+}
+
+func TestHealth(t *testing.T) {
+	atomic.StoreInt32(&isShuttingDown, 0)
+	RegisterHealthCheck("live", func(ctx context.Context) error {
+		return nil
+	})
+	RegisterReadinessCheck("ready", func(ctx context.Context) error {
+		return errors.New("Not ready. ")
+	})
+
+	recorder := httptest.NewRecorder()
+	Router().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	var result HealthResult
+	_ = json.Unmarshal(recorder.Body.Bytes(), &result)
+	if recorder.Code != http.StatusOK || result.Status != HealthUp || len(result.Checks) != 1 {
+		t.Fatal("Unexpected liveness ", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	Router().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	_ = json.Unmarshal(recorder.Body.Bytes(), &result)
+	if recorder.Code != http.StatusServiceUnavailable || result.Status != HealthDown || len(result.Checks) != 2 ||
+		result.Checks[1].Error != "Not ready. " || len(result.Checks[1].Latency) == 0 {
+		t.Fatal("Unexpected readiness ", recorder.Code, recorder.Body.String())
+	}
+
+	RegisterReadinessCheck("ready", func(ctx context.Context) error {
+		return nil
+	})
+	if CheckHealth(true).Status != HealthUp {
+		t.Fatal("Replaced check should be up. ")
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	counter, err := NewCounter("test_jobs_total", "Jobs processed.", "result")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewCounter("test_jobs_total", ""); err == nil {
+		t.Fatal("Duplicate metric should be rejected. ")
+	}
+	histogram, _ := NewHistogram("test_latency_seconds", "", []float64{1, 0.1})
+	counter.Inc("ok")
+	counter.Add(2, "ok")
+	counter.Inc("fail\"")
+	histogram.Observe(0.05)
+	histogram.Observe(0.5)
+	Router().GET("/api/metrics/:id", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	Router().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/metrics/1", nil))
+
+	recorder := httptest.NewRecorder()
+	Router().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := recorder.Body.String()
+	for _, line := range []string{
+		"# HELP test_jobs_total Jobs processed.",
+		"# TYPE test_jobs_total counter",
+		`test_jobs_total{result="ok"} 3`,
+		`test_jobs_total{result="fail\""} 1`,
+		`test_latency_seconds_bucket{le="0.1"} 1`,
+		`test_latency_seconds_bucket{le="1"} 2`,
+		`test_latency_seconds_bucket{le="+Inf"} 2`,
+		"test_latency_seconds_sum 0.55",
+		"test_latency_seconds_count 2",
+		`http_requests_total{method="GET",route="/api/metrics/:id",status="200"} 1`,
+		"# TYPE websocket_connections gauge",
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Fatal("Metrics should contain ", line, "\n", body)
+		}
+	}
+}
+
+func TestListeners(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gravity_listener")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	socket := filepath.Join(dir, "admin.sock")
+	if err := AddListener(ListenerOptions{Network: NetworkUnix, Address: socket, Mode: 0600, Prefixes: []string{"/api/admin/"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddListener(ListenerOptions{Network: "udp", Address: ":0"}); err == nil {
+		t.Fatal("Invalid network should be rejected. ")
+	}
+	Router().GET("/api/admin/status", func(c *gin.Context) {
+		c.String(http.StatusOK, "admin")
+	})
+	Router().GET("/api/public", func(c *gin.Context) {
+		c.String(http.StatusOK, "public")
+	})
+
+	os.Args = append(os.Args, "server.port=8084", "server.listen=127.0.0.1:8085")
+	config.LoadArgs()
+	result := make(chan error, 1)
+	go func() {
+		result <- Run()
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatal("Unexpected socket mode ", info.Mode())
+	}
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return net.Dial("unix", socket)
+		},
+	}}
+	get := func(client *http.Client, url string) (int, string) {
+		response, err := client.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			_ = response.Body.Close()
+		}()
+		body, _ := ioutil.ReadAll(response.Body)
+		return response.StatusCode, string(body)
+	}
+	if code, body := get(client, "http://unix/api/admin/status"); code != http.StatusOK || body != "admin" {
+		t.Fatal("Unexpected response ", code, body)
+	}
+	if code, _ := get(client, "http://unix/api/public"); code != http.StatusNotFound {
+		t.Fatal("Route outside of prefixes should not be served. ")
+	}
+	if code, body := get(http.DefaultClient, "http://127.0.0.1:8085/api/public"); code != http.StatusOK || body != "public" {
+		t.Fatal("Unexpected response ", code, body)
+	}
+
+	if err := Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	<-result
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Fatal("Socket should be removed after shutdown. ")
+	}
+
+	occupied, err := net.Listen("tcp", ":8084")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = occupied.Close()
+	}()
+	if err := Run(); err == nil {
+		t.Fatal("Run should fail when the port is in use. ")
+	}
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Fatal("Socket should not be left when Run fails. ")
+	}
+	if conn, err := net.Dial("tcp", "127.0.0.1:8085"); err == nil {
+		_ = conn.Close()
+		t.Fatal("Listener should not be left when Run fails. ")
+	}
+	listenerList = nil
+}
+
+type accessLogBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *accessLogBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *accessLogBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	defer b.buffer.Reset()
+	return b.buffer.String()
+}
+
+func TestAccessLog(t *testing.T) {
+	buffer := new(accessLogBuffer)
+	SetAccessLogWriter(buffer)
+	defer SetAccessLogWriter(nil)
+	Router().GET("/api/access", func(c *gin.Context) {
+		c.Set("Username", "admin")
+		c.String(http.StatusOK, "hello")
+	})
+	get := func(target string, requestId ...string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, target, nil)
+		request.Header.Set(RequestIdHeader, "request-1")
+		if len(requestId) != 0 {
+			request.Header.Set(RequestIdHeader, requestId[0])
+		}
+		request.Header.Set("User-Agent", "gravity-test")
+		request.Header.Set("X-Forwarded-For", "203.0.113.1")
+		recorder := httptest.NewRecorder()
+		Router().ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	if get("/api/access?a=1").Header().Get(RequestIdHeader) != "request-1" {
+		t.Fatal("Request ID should be echoed. ")
+	}
+	line := buffer.String()
+	if !strings.Contains(line, `- admin [`) || !strings.Contains(line, `"GET /api/access?a=1 HTTP/1.1" 200 5 `) ||
+		!strings.HasSuffix(line, " request-1\n") {
+		t.Fatal("Unexpected common log ", line)
+	}
+	for _, requestId := range []string{`bad "id"`, strings.Repeat("a", 129)} {
+		echoed := get("/api/access", requestId).Header().Get(RequestIdHeader)
+		if echoed == requestId || !isValidRequestId(echoed) {
+			t.Fatal("Invalid request ID should be replaced, got ", echoed)
+		}
+		if line = buffer.String(); !strings.HasSuffix(line, " "+echoed+"\n") {
+			t.Fatal("Unexpected common log ", line)
+		}
+	}
+
+	os.Args = append(os.Args, "server.accessLog.format=combined")
+	config.LoadArgs()
+	get("/api/access")
+	if line = buffer.String(); !strings.Contains(line, `"" "gravity-test"`) {
+		t.Fatal("Unexpected combined log ", line)
+	}
+	request := httptest.NewRequest(http.MethodGet, "/api/access", nil)
+	request.Header.Set("User-Agent", `fake" "agent\`)
+	Router().ServeHTTP(httptest.NewRecorder(), request)
+	if line = buffer.String(); !strings.Contains(line, `"" "fake\" \"agent\\"`) {
+		t.Fatal("Quoted fields should be escaped ", line)
+	}
+
+	os.Args = append(os.Args, "server.accessLog.format=json")
+	config.LoadArgs()
+	get("/api/access")
+	var record accessRecord
+	if err := json.Unmarshal([]byte(buffer.String()), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.User != "admin" || record.Status != http.StatusOK || record.Bytes != 5 || record.RequestId != "request-1" ||
+		record.Remote != "192.0.2.1" {
+		t.Fatal("Unexpected json log ", record)
+	}
+
+	get("/healthz")
+	if line = buffer.String(); len(line) != 0 {
+		t.Fatal("Excluded path should not be logged ", line)
+	}
+}
+
+func TestProxy(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if websocket.IsWebSocketUpgrade(r) {
+			var upgrader websocket.Upgrader
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer func() {
+				_ = conn.Close()
+			}()
+			messageType, message, err := conn.ReadMessage()
+			if err == nil {
+				_ = conn.WriteMessage(messageType, message)
+			}
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/identity") {
+			_, _ = w.Write([]byte(r.URL.RequestURI() + "|" + r.Header.Get("Authorization") + "|" +
+				r.Header.Get(ProxyUserIdHeader) + "|" + r.Header.Get(ProxyUsernameHeader)))
+			return
+		}
+		_, _ = w.Write([]byte(r.URL.RequestURI() + " " + r.Header.Get("X-Test") + " " + r.Header.Get(RequestIdHeader)))
+	}))
+	defer backend.Close()
+
+	err := Proxy("/legacy", backend.URL+"/base", ProxyOptions{
+		StripPrefix: true,
+		Headers:     map[string]string{"X-Test": "injected"},
+		Middle: []gin.HandlerFunc{func(c *gin.Context) {
+			if len(c.GetHeader("X-Block")) != 0 {
+				c.AbortWithStatus(http.StatusUnauthorized)
+			}
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Proxy("/invalid", "127.0.0.1:80", ProxyOptions{}); err == nil {
+		t.Fatal("Invalid target should be rejected. ")
+	}
+	Router().GET("/conflict/:id", func(c *gin.Context) {})
+	if err := Proxy("/conflict", backend.URL, ProxyOptions{}); err == nil {
+		t.Fatal("Conflicting route should be rejected. ")
+	}
+	front := httptest.NewServer(Router())
+	defer front.Close()
+
+	request, _ := http.NewRequest(http.MethodGet, front.URL+"/legacy/users?id=1", nil)
+	request.Header.Set(RequestIdHeader, "proxy-1")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(response.Body)
+	_ = response.Body.Close()
+	if string(body) != "/base/users?id=1 injected proxy-1" {
+		t.Fatal("Unexpected proxy response ", string(body))
+	}
+
+	request, _ = http.NewRequest(http.MethodGet, front.URL+"/legacy/identity?a=1&token=secret", nil)
+	request.Header.Set("Authorization", "secret")
+	request.Header.Set(ProxyUserIdHeader, "0")
+	request.Header.Set(ProxyUsernameHeader, "root")
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = ioutil.ReadAll(response.Body)
+	_ = response.Body.Close()
+	if string(body) != "/base/identity?a=1|||" {
+		t.Fatal("Credentials and identity headers should be stripped ", string(body))
+	}
+
+	request, _ = http.NewRequest(http.MethodGet, front.URL+"/legacy/users", nil)
+	request.Header.Set("X-Block", "1")
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = response.Body.Close()
+	if response.StatusCode != http.StatusUnauthorized {
+		t.Fatal("Middleware should be applied. ")
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(front.URL, "http")+"/legacy/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	_ = conn.WriteMessage(websocket.TextMessage, []byte("proxied"))
+	if _, message, err := conn.ReadMessage(); err != nil || string(message) != "proxied" {
+		t.Fatal("Websocket should be proxied. error: ", err)
+	}
+
+	backend.Close()
+	response, err = http.Get(front.URL + "/legacy/users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = response.Body.Close()
+	if response.StatusCode != http.StatusBadGateway {
+		t.Fatal("Unavailable backend should return 502. ")
+	}
+}
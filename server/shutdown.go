@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/infinit-lab/gravity/printer"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+)
+
+type ShutdownHookFunc func(ctx context.Context) error
+
+type shutdownHook struct {
+	name     string
+	priority int
+	index    int
+	hook     ShutdownHookFunc
+}
+
+var shutdownHookList []*shutdownHook
+var shutdownHookIndex int
+var shutdownHookMutex sync.Mutex
+
+var websocketMap = make(map[*websocketImpl]bool)
+var websocketMutex sync.Mutex
+
+func RegisterShutdownHook(name string, priority int, hook ShutdownHookFunc) {
+	shutdownHookMutex.Lock()
+	defer shutdownHookMutex.Unlock()
+	h := new(shutdownHook)
+	h.name = name
+	h.priority = priority
+	h.index = shutdownHookIndex
+	h.hook = hook
+	shutdownHookIndex++
+	shutdownHookList = append(shutdownHookList, h)
+	sort.SliceStable(shutdownHookList, func(i, j int) bool {
+		if shutdownHookList[i].priority != shutdownHookList[j].priority {
+			return shutdownHookList[i].priority > shutdownHookList[j].priority
+		}
+		return shutdownHookList[i].index < shutdownHookList[j].index
+	})
+}
+
+func runShutdownHooks(ctx context.Context) {
+	shutdownHookMutex.Lock()
+	list := make([]*shutdownHook, len(shutdownHookList))
+	copy(list, shutdownHookList)
+	shutdownHookMutex.Unlock()
+
+	for _, h := range list {
+		if err := callShutdownHook(ctx, h); err != nil {
+			printer.Error("Shutdown hook ", h.name, " failed. error: ", err)
+		}
+	}
+}
+
+func callShutdownHook(ctx context.Context, h *shutdownHook) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("%v", e)
+		}
+	}()
+	return h.hook(ctx)
+}
+
+func handleSignal() func() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+	quit := make(chan struct{})
+	go func() {
+		select {
+		case s := <-c:
+			printer.Trace("Received signal ", s, ". Shutting down. ")
+			if err := Shutdown(); err != nil {
+				printer.Error(err)
+			}
+		case <-quit:
+		}
+	}()
+	return func() {
+		signal.Stop(c)
+		close(quit)
+	}
+}
+
+func addWebsocket(w *websocketImpl) {
+	websocketMutex.Lock()
+	defer websocketMutex.Unlock()
+	websocketMap[w] = true
+	websocketGauge.Inc()
+}
+
+func removeWebsocket(w *websocketImpl) {
+	websocketMutex.Lock()
+	defer websocketMutex.Unlock()
+	if websocketMap[w] {
+		delete(websocketMap, w)
+		websocketGauge.Dec()
+	}
+}
+
+func closeWebsockets() {
+	websocketMutex.Lock()
+	list := make([]*websocketImpl, 0, len(websocketMap))
+	for w := range websocketMap {
+		list = append(list, w)
+	}
+	websocketMutex.Unlock()
+
+	for _, w := range list {
+		if err := w.closeWithCode(websocket.CloseGoingAway, "Server is shutting down. "); err != nil {
+			printer.Error(err)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/infinit-lab/gravity/config"
+	"github.com/infinit-lab/gravity/printer"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	ClientAuthNone     string = "none"
+	ClientAuthOptional string = "optional"
+	ClientAuthRequire  string = "require"
+)
+
+type certificateLoader struct {
+	certFile   string
+	keyFile    string
+	caFile     string
+	clientAuth tls.ClientAuthType
+	interval   time.Duration
+
+	mutex       sync.Mutex
+	certificate *tls.Certificate
+	clientCAs   *x509.CertPool
+	modTime     time.Time
+	checkTime   time.Time
+}
+
+func newCertificateLoader(certFile, keyFile, caFile, clientAuth string) (*certificateLoader, error) {
+	l := new(certificateLoader)
+	l.certFile = certFile
+	l.keyFile = keyFile
+	l.caFile = caFile
+	l.interval = time.Second
+
+	switch clientAuth {
+	case "":
+		if len(caFile) != 0 {
+			l.clientAuth = tls.RequireAndVerifyClientCert
+		} else {
+			l.clientAuth = tls.NoClientCert
+		}
+	case ClientAuthNone:
+		l.clientAuth = tls.NoClientCert
+	case ClientAuthOptional:
+		l.clientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		l.clientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, errors.New("Invalid client auth " + clientAuth + ". ")
+	}
+	if l.clientAuth != tls.NoClientCert && len(caFile) == 0 {
+		return nil, errors.New("CA file is required to verify client certificates. ")
+	}
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *certificateLoader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{l.certFile, l.keyFile, l.caFile} {
+		if len(file) == 0 {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (l *certificateLoader) load() error {
+	modTime, err := l.latestModTime()
+	if err != nil {
+		return err
+	}
+	certificate, err := tls.LoadX509KeyPair(l.certFile, l.keyFile)
+	if err != nil {
+		return err
+	}
+	var clientCAs *x509.CertPool
+	if len(l.caFile) != 0 {
+		data, err := ioutil.ReadFile(l.caFile)
+		if err != nil {
+			return err
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(data) {
+			return errors.New("No certificate found in " + l.caFile + ". ")
+		}
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.certificate = &certificate
+	l.clientCAs = clientCAs
+	l.modTime = modTime
+	l.checkTime = time.Now()
+	return nil
+}
+
+func (l *certificateLoader) reload() {
+	l.mutex.Lock()
+	if time.Since(l.checkTime) < l.interval {
+		l.mutex.Unlock()
+		return
+	}
+	l.checkTime = time.Now()
+	modTime := l.modTime
+	l.mutex.Unlock()
+
+	latest, err := l.latestModTime()
+	if err != nil {
+		printer.Error(err)
+		return
+	}
+	if !latest.After(modTime) {
+		return
+	}
+	if err := l.load(); err != nil {
+		printer.Error("Failed to reload certificate. error: ", err)
+		return
+	}
+	printer.Trace("Certificate ", l.certFile, " is reloaded. ")
+}
+
+func (l *certificateLoader) config() *tls.Config {
+	c := new(tls.Config)
+	c.MinVersion = tls.VersionTLS12
+	c.NextProtos = []string{"h2", "http/1.1"}
+	c.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		l.reload()
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		return l.certificate, nil
+	}
+	c.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		l.reload()
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		temp := new(tls.Config)
+		temp.MinVersion = tls.VersionTLS12
+		temp.NextProtos = c.NextProtos
+		temp.Certificates = []tls.Certificate{*l.certificate}
+		temp.ClientAuth = l.clientAuth
+		temp.ClientCAs = l.clientCAs
+		return temp, nil
+	}
+	return c
+}
+
+func tlsConfig() (*tls.Config, error) {
+	certFile := config.GetString("server.tls.cert")
+	keyFile := config.GetString("server.tls.key")
+	if len(certFile) == 0 && len(keyFile) == 0 {
+		return nil, nil
+	}
+	if len(certFile) == 0 || len(keyFile) == 0 {
+		return nil, errors.New("Both server.tls.cert and server.tls.key are required. ")
+	}
+	l, err := newCertificateLoader(certFile, keyFile, config.GetString("server.tls.ca"), config.GetString("server.tls.clientAuth"))
+	if err != nil {
+		return nil, err
+	}
+	return l.config(), nil
+}
+
+func newRedirectServer(port int, httpsPort int) *http.Server {
+	s := new(http.Server)
+	s.Addr = fmt.Sprintf(":%d", port)
+	s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if httpsPort != 443 {
+			host = fmt.Sprintf("%s:%d", host, httpsPort)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+	return s
+}